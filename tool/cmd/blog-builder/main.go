@@ -2,61 +2,557 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/rmarken5/blog-builder/tool/logic/aws"
 	"github.com/rmarken5/blog-builder/tool/logic/build"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/history"
+	"github.com/rmarken5/blog-builder/tool/logic/release"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
 )
 
-var bucketName = flag.String("bucket-name", "", "name of s3 bucket")
-var region = flag.String("region", "us-east-2", "name of s3 region")
+var targetURL = flag.String("target", "", "where to publish the site: s3://bucket/prefix, file:///srv/www or mem://, same as deploy.target in the config")
+var bucketName = flag.String("bucket-name", "", "name of s3 bucket, shorthand for -target s3://<bucket-name>/<prefix>")
+var region = flag.String("region", "", "name of s3 region, same as s3.region in the config which defaults to us-east-2")
+var endpointURL = flag.String("endpoint-url", "", "url of an S3 compatible endpoint such as MinIO or R2, same as s3.endpoint in the config")
+var pathStyle = flag.Bool("path-style", false, "address the bucket in the url path instead of the host name, same as s3.path_style in the config")
+var profile = flag.String("profile", "", "aws shared config profile to take credentials from, same as s3.profile in the config")
 var markdownDir = flag.String("markdown-directory", "markdown", "path to markdown content directory")
 var cssDirectory = flag.String("css-directory", "css", "path to css content directory")
+var staticDirectory = flag.String("static-directory", "static", "path to static files copied verbatim into the build, such as images, fonts and js")
 var outputDir = flag.String("output-directory", "build", "path to output directory")
+var themeDirectory = flag.String("theme-directory", "themes", "path to theme directory, any file in it overrides the embedded default theme by name")
+var layoutsDirectory = flag.String("layouts-directory", "layouts", "path to html layouts directory, any file in it overrides the theme layouts by name")
+var redirectsFile = flag.String("redirects-file", build.DefaultRedirectsPath, "path to a yaml list of old paths of the site and where they moved to, in addition to the aliases in front matter")
+var configPath = flag.String("config", config.DefaultPath, "path to the blog config file")
 var withoutBuildOutput = flag.Bool("disable-local-output", false, "setting disable-local-output will upload files directly without writing to local build directory")
-var disableUpload = flag.Bool("disable-upload", false, "setting the disable-upload flag will run the build without pushing the build to s3")
+var disableUpload = flag.Bool("disable-upload", false, "setting the disable-upload flag will run the build without publishing it to the target")
+var prune = flag.Bool("prune", false, "delete files from the target that are no longer part of the build, same as deploy.prune in the config; with the releases command delete old releases instead")
+var prefix = flag.String("prefix", "", "key prefix the site lives under in the bucket given by -bucket-name, same as deploy.prefix in the config")
+var force = flag.Bool("force", false, "upload every file even when the target already holds it, so changed deploy.rules reach unchanged files")
+var compression = flag.String("compress", "", "build html, css, js, xml and json compressed with gzip or br, same as deploy.compression in the config")
+var concurrency = flag.Int("concurrency", 0, "number of files uploaded at the same time, same as deploy.concurrency in the config")
+var from = flag.String("from", "", "build output directory to deploy or plan from instead of building, defaults to -output-directory for the deploy command")
+var planFormat = flag.String("format", build.PlanFormatText, "output format of the plan command, text or json")
+var releases = flag.Bool("releases", false, "upload the deploy as a new release and switch to it in one step, same as deploy.releases.enabled in the config")
+var releaseID = flag.String("release-id", "", "id of the release to deploy, such as a git sha, defaults to the deploy time; with rollback the release to switch to, defaults to the one before the active release")
+var commit = flag.String("commit", "", "git commit recorded in the deploy history, defaults to the HEAD of the repository in the working directory")
+var historyKey = flag.String("key", "", "with the history command, only list the deploys that added, changed or deleted this key")
+var distributionID = flag.String("distribution-id", "", "CloudFront distribution to invalidate the changed paths of after a deploy, same as cloudfront.distribution_id in the config")
+var waitInvalidation = flag.Bool("wait-invalidation", false, "wait for the CloudFront invalidation to complete, same as cloudfront.wait in the config")
+var keep = flag.Int("keep", -1, "number of releases kept besides the active one, same as deploy.releases.keep in the config")
+
+const (
+	commandBuild    = "build"
+	commandPlan     = "plan"
+	commandDeploy   = "deploy"
+	commandRollback = "rollback"
+	commandReleases = "releases"
+	commandHistory  = "history"
+	commandInit     = "init-bucket"
+)
+
+// version is the version of the tool recorded in the deploy history, set with
+// -ldflags "-X main.version=v1.2.3". It falls back to the module version of the binary.
+var version = ""
+
+var errUsage = errors.New("usage error")
+
+// Exit codes, so CI can tell a broken site from a broken deploy.
+const (
+	exitBuildFailed        = 1
+	exitUploadFailed       = 2
+	exitDeployAborted      = 3
+	exitInvalidationFailed = 4
+	exitBucketSetupFailed  = 5
+	exitUsage              = 99
+)
 
 func main() {
 
-	flag.Parse()
-	shouldBuildLocal := !*withoutBuildOutput
-	log.Println("WithoutUpload: ", *disableUpload)
-	uploadDisabled := *disableUpload
+	command := commandBuild
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 
-	if !uploadDisabled && (bucketName == nil || *bucketName == "") {
-		log.Printf("-bucket-name is required")
-		os.Exit(99)
+	switch command {
+	case commandBuild, commandPlan, commandDeploy, commandRollback, commandReleases, commandHistory, commandInit:
+	default:
+		log.Printf("unknown command %q", command)
+		usage()
+		os.Exit(exitUsage)
+	}
+	if err := checkArgs(command, flag.Args()); err != nil {
+		log.Print(err)
+		usage()
+		os.Exit(exitUsage)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(*region))
+	shouldBuildLocal := !*withoutBuildOutput
+	uploadDisabled := *disableUpload
+
+	blogConfig, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	blogConfig = applyFlags(blogConfig)
+
+	needsTarget := command != commandBuild || !uploadDisabled
+	if needsTarget && blogConfig.Deploy.Target == "" {
+		log.Printf("-target or -bucket-name is required")
+		os.Exit(exitUsage)
+	}
+
+	// Ctrl-C stops starting new uploads and lets the ones in flight finish or fail
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if command == commandInit {
+		err = initBucket(ctx, blogConfig)
+		if err != nil {
+			slog.Error("error setting up bucket", "error", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// the target is only opened when publishing, so a local build needs no credentials
+	var dest target.Target
+	if needsTarget {
+		retryPolicy := aws.DefaultRetryPolicy()
+		retryPolicy.MaxAttempts = blogConfig.Deploy.MaxAttempts
+		dest, err = target.Open(ctx, blogConfig.Deploy.Target, blogConfig.S3, retryPolicy)
+		if err != nil {
+			log.Printf("error opening target: %v", err)
+			os.Exit(exitUsage)
+		}
+		// a directory cannot tell the web server a file is compressed, which would serve it as garbage
+		if _, ok := dest.(*target.Directory); ok && blogConfig.Deploy.Compression != "" {
+			log.Printf("deploy.compression needs a target that keeps the Content-Encoding of a file, such as s3://")
+			os.Exit(exitUsage)
+		}
+	}
+
+	if command == commandRollback || command == commandReleases {
+		err = manageReleases(ctx, command, dest, blogConfig)
+		if err != nil {
+			slog.Error("error managing releases", "error", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+	if command == commandHistory {
+		err = showHistory(ctx, dest, flag.Args())
+		if err != nil {
+			slog.Error("error reading deploy history", "error", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	artifactDir := *from
+	if artifactDir == "" && command == commandDeploy {
+		artifactDir = *outputDir
+	}
+
+	var outputFiles []build.OutputFile
+	if artifactDir != "" {
+		log.Printf("loading build from %s", artifactDir)
+		outputFiles, err = build.LoadArtifact(artifactDir)
+		if err != nil {
+			slog.Error("error loading build output", "error", err)
+			os.Exit(exitBuildFailed)
+		}
+	} else {
+		outputFiles, err = renderSite(ctx, blogConfig)
+		if err != nil {
+			slog.Error("error building html from markdown", "error", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	publisher := build.NewPublisher(blogConfig.Deploy)
+	if command == commandPlan {
+		planTarget, err := liveTarget(ctx, dest, blogConfig.Deploy.Releases)
+		if err != nil {
+			log.Printf("error finding the active release: %v", err)
+			os.Exit(exitCode(err))
+		}
+		plan, err := publisher.Plan(ctx, planTarget, outputFiles)
+		if err != nil && !errors.Is(err, build.ErrPruneThreshold) {
+			log.Printf("error planning deploy: %v", err)
+			os.Exit(exitBuildFailed)
+		}
+		if writeErr := build.WritePlan(os.Stdout, plan, *planFormat); writeErr != nil {
+			log.Printf("error writing plan: %v", writeErr)
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			log.Printf("deploy would abort: %v", err)
+			os.Exit(exitDeployAborted)
+		}
+		return
+	}
 
-	// Create an Amazon S3 service client
-	client := s3.NewFromConfig(cfg)
-	ctx := context.Background()
+	if command == commandBuild && shouldBuildLocal {
+		log.Printf("building to %s", *outputDir)
+		err = build.WriteArtifact(*outputDir, outputFiles)
+		if err != nil {
+			slog.Error("error writing build output", "error", err)
+			os.Exit(exitBuildFailed)
+		}
+	}
+	if command == commandDeploy || !uploadDisabled {
+		err = publish(ctx, publisher, dest, outputFiles, blogConfig)
+		if err != nil {
+			slog.Error("error publishing build to target", "error", err)
+			os.Exit(exitCode(err))
+		}
+	}
+}
 
+// applyFlags returns blogConfig with the values given on the command line in place of those of
+// the config file.
+func applyFlags(blogConfig config.Config) config.Config {
+	if *prune {
+		blogConfig.Deploy.Prune = true
+	}
+	if *force {
+		blogConfig.Deploy.Force = true
+	}
+	if *compression != "" {
+		blogConfig.Deploy.Compression = *compression
+	}
+	if *concurrency > 0 {
+		blogConfig.Deploy.Concurrency = *concurrency
+	}
+	if *prefix != "" {
+		blogConfig.Deploy.Prefix = *prefix
+	}
+	if *releases {
+		blogConfig.Deploy.Releases.Enabled = true
+	}
+	if *keep >= 0 {
+		blogConfig.Deploy.Releases.Keep = *keep
+	}
+	if *targetURL != "" {
+		blogConfig.Deploy.Target = *targetURL
+	} else if *bucketName != "" {
+		blogConfig.Deploy.Target = target.S3URL(*bucketName, blogConfig.Deploy.Prefix)
+	}
+	if *distributionID != "" {
+		blogConfig.CloudFront.DistributionID = *distributionID
+	}
+	if *waitInvalidation {
+		blogConfig.CloudFront.Wait = true
+	}
+	if *region != "" {
+		blogConfig.S3.Region = *region
+	}
+	if *endpointURL != "" {
+		blogConfig.S3.Endpoint = *endpointURL
+	}
+	if *pathStyle {
+		blogConfig.S3.PathStyle = true
+	}
+	if *profile != "" {
+		blogConfig.S3.Profile = *profile
+	}
+	return blogConfig
+}
+
+// renderSite builds the site from the markdown, css, static and theme directories.
+func renderSite(ctx context.Context, blogConfig config.Config) ([]build.OutputFile, error) {
 	htmlHandler := build.NewHandleHTML(*markdownDir, *outputDir)
 	cssHandler := build.NewHandleCSS(*cssDirectory, *outputDir+"/css", ".css")
 	mdHandler := build.NewHandleMarkdown()
-	payloadBuilder := build.NewPayloadBuilder(htmlHandler, cssHandler, mdHandler, aws.New(client, *bucketName))
+	themeHandler, err := build.NewHandleTheme(*themeDirectory, *layoutsDirectory)
+	if err != nil {
+		return nil, err
+	}
+	layoutHandler, err := build.NewHandleLayout(themeHandler.Layouts(), blogConfig.Site)
+	if err != nil {
+		return nil, err
+	}
+	feedHandler := build.NewHandleFeed(blogConfig.Site, blogConfig.Feed)
+	sitemapHandler := build.NewHandleSitemap(blogConfig.Site, blogConfig.Sitemap, blogConfig.Robots)
+	assetHandler := build.NewHandleAsset(*staticDirectory)
+	redirectHandler := build.NewHandleRedirect(blogConfig.Site, *redirectsFile)
+	payloadBuilder := build.NewPayloadBuilder(htmlHandler, cssHandler, mdHandler, layoutHandler, themeHandler, feedHandler, sitemapHandler, assetHandler, redirectHandler, blogConfig.Deploy.Compression)
+
+	return payloadBuilder.RenderSite(ctx, *markdownDir, *outputDir)
+}
 
-	if shouldBuildLocal {
-		err = payloadBuilder.BuildPayload(ctx, *markdownDir, *outputDir)
+// publish deploys files to dest, as a new release when releases are enabled, records the deploy
+// in the history kept on dest and invalidates what changed in the CDN.
+func publish(ctx context.Context, publisher *build.Publisher, dest target.Target, files []build.OutputFile, blogConfig config.Config) error {
+	releases := blogConfig.Deploy.Releases
+	record := history.Record{
+		Time:    time.Now().UTC(),
+		Version: toolVersion(),
+		Commit:  gitCommit(),
+	}
+	var result build.DeployResult
+	deploy := func(ctx context.Context, dest target.Target) error {
+		var err error
+		result, err = publisher.Deploy(ctx, dest, files)
+		return err
+	}
+
+	var manager *release.Manager
+	if releases.Enabled {
+		var err error
+		manager, err = release.NewManager(dest)
 		if err != nil {
-			slog.Error("error building html from markdown")
+			return err
+		}
+		record.Release = *releaseID
+		if record.Release == "" {
+			record.Release = release.NewID(record.Time)
 		}
+		log.Printf("deploying release %s", record.Release)
+		if err := manager.Publish(ctx, record.Release, record.Time, deploy); err != nil {
+			return err
+		}
+	} else if err := deploy(ctx, dest); err != nil {
+		return err
+	}
+
+	record.Files, record.Uploaded, record.Deleted = result.Hashes, result.Uploaded, result.Deleted
+	record, err := history.NewLog(dest).Save(ctx, record)
+	if err != nil {
+		return fmt.Errorf("error recording deploy: %w", err)
+	}
+	log.Printf("recorded deploy %s", record.ID)
+
+	// switching releases changes every page at once
+	paths := []string{"/*"}
+	if manager == nil {
+		paths = aws.InvalidationPaths(slices.Concat(record.Uploaded, record.Deleted), blogConfig.CloudFront.MaxPaths)
+	}
+	if err := invalidate(ctx, blogConfig, paths); err != nil {
+		return err
 	}
-	if !uploadDisabled {
-		err = payloadBuilder.BuildToS3(ctx, *markdownDir, *outputDir)
+
+	if manager != nil && releases.Keep > 0 {
+		removed, err := manager.Prune(ctx, releases.Keep)
 		if err != nil {
-			slog.Error("error sending build to s3")
+			return fmt.Errorf("error removing old releases: %w - %w", err, build.ErrPruneFailed)
+		}
+		if len(removed) > 0 {
+			log.Printf("removed old releases %s", strings.Join(removed, ", "))
 		}
 	}
+	return nil
+}
+
+// liveTarget returns the part of dest visitors currently see: dest itself, or with releases the
+// active release. When no release is active yet that is nothing at all.
+func liveTarget(ctx context.Context, dest target.Target, releases config.Releases) (target.Target, error) {
+	if !releases.Enabled {
+		return dest, nil
+	}
+	manager, err := release.NewManager(dest)
+	if err != nil {
+		return nil, err
+	}
+	active, ok, err := manager.Active(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return target.NewMemory(), nil
+	}
+	return manager.Target(active.ID), nil
+}
+
+// manageReleases runs the rollback and releases commands.
+func manageReleases(ctx context.Context, command string, dest target.Target, blogConfig config.Config) error {
+	releases := blogConfig.Deploy.Releases
+	manager, err := release.NewManager(dest)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case command == commandRollback:
+		rolledBack, err := manager.Rollback(ctx, *releaseID)
+		if err != nil {
+			return err
+		}
+		log.Printf("rolled back to release %s", rolledBack.ID)
+		return invalidate(ctx, blogConfig, []string{"/*"})
+	case *prune:
+		if releases.Keep <= 0 {
+			return fmt.Errorf("releases -prune needs -keep or deploy.releases.keep above zero, zero keeps every release: %w", errUsage)
+		}
+		removed, err := manager.Prune(ctx, releases.Keep)
+		if len(removed) > 0 {
+			log.Printf("removed releases %s", strings.Join(removed, ", "))
+		}
+		return err
+	}
+
+	list, err := manager.List(ctx)
+	if err != nil {
+		return err
+	}
+	return release.WriteList(os.Stdout, list)
+}
+
+// initBucket creates and sets up the bucket of the s3 target for website hosting.
+func initBucket(ctx context.Context, blogConfig config.Config) error {
+	bucketName, bucketPrefix, err := target.ParseS3URL(blogConfig.Deploy.Target)
+	if err != nil {
+		return fmt.Errorf("%w - %w", err, errUsage)
+	}
+	client, err := aws.NewS3Client(ctx, blogConfig.S3)
+	if err != nil {
+		return fmt.Errorf("%w - %w", err, aws.ErrBucketSetup)
+	}
+	log.Printf("setting up bucket %s for %s access", bucketName, blogConfig.Bucket.Access)
+	if err := aws.NewBucket(client, bucketName, bucketPrefix, blogConfig.S3.Region).Init(ctx, blogConfig.Bucket); err != nil {
+		return err
+	}
+	log.Printf("bucket %s is ready, deploy with -target %s", bucketName, blogConfig.Deploy.Target)
+	return nil
+}
+
+// invalidate clears paths from the CloudFront cache when a distribution is configured.
+func invalidate(ctx context.Context, blogConfig config.Config, paths []string) error {
+	distribution := blogConfig.CloudFront
+	if distribution.DistributionID == "" || len(paths) == 0 {
+		return nil
+	}
+	client, err := aws.NewCloudFrontClient(ctx, blogConfig.S3)
+	if err != nil {
+		return fmt.Errorf("%w - %w", err, aws.ErrInvalidation)
+	}
+	cdn := aws.NewCDN(client, distribution.DistributionID)
+
+	id, err := cdn.Invalidate(ctx, paths)
+	if err != nil {
+		return err
+	}
+	log.Printf("created invalidation %s for %s", id, strings.Join(paths, " "))
+	if !distribution.Wait {
+		return nil
+	}
+	log.Printf("waiting for invalidation %s to complete", id)
+	if err := cdn.Wait(ctx, id, distribution.WaitTimeout); err != nil {
+		return err
+	}
+	log.Printf("invalidation %s completed", id)
+	return nil
+}
+
+// showHistory lists the recorded deploys, or with two deploy ids as args prints what changed between them.
+func showHistory(ctx context.Context, dest target.Target, args []string) error {
+	deployLog := history.NewLog(dest)
+	switch len(args) {
+	case 0:
+		records, err := deployLog.List(ctx)
+		if err != nil {
+			return err
+		}
+		if *historyKey != "" {
+			records = history.Touching(records, *historyKey)
+		}
+		return history.WriteList(os.Stdout, records)
+	case 2:
+		from, err := deployLog.Load(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := deployLog.Load(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return history.WriteDiff(os.Stdout, history.Diff(from, to))
+	}
+	return fmt.Errorf("history takes no deploy ids or two to compare, got %d: %w", len(args), errUsage)
+}
+
+// toolVersion returns the version recorded in the deploy history.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// gitCommit returns -commit, or the HEAD of the repository in the working directory when there is one.
+func gitCommit() string {
+	if *commit != "" {
+		return *commit
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// checkArgs rejects arguments left after the flags. Only history takes any, the deploy ids it
+// compares, so a command given after the flags is not silently run as a build.
+func checkArgs(command string, args []string) error {
+	if len(args) == 0 || command == commandHistory {
+		return nil
+	}
+	return fmt.Errorf("unexpected arguments %q after the flags of %s, the command goes before its flags: %w", args, command, errUsage)
+}
+
+// exitCode maps a failed deploy to the exit code CI should see.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, build.ErrPruneThreshold):
+		return exitDeployAborted
+	case errors.Is(err, build.ErrUploadsFailed), errors.Is(err, build.ErrPruneFailed),
+		errors.Is(err, aws.ErrUploadFile), errors.Is(err, aws.ErrDeleteFile),
+		errors.Is(err, target.ErrWriteFile), errors.Is(err, target.ErrDeleteFile):
+		return exitUploadFailed
+	case errors.Is(err, aws.ErrInvalidation):
+		return exitInvalidationFailed
+	case errors.Is(err, aws.ErrBucketSetup):
+		return exitBucketSetupFailed
+	case errors.Is(err, release.ErrUnsupported), errors.Is(err, release.ErrInvalidID), errors.Is(err, build.ErrUnknownEncoding),
+		errors.Is(err, release.ErrUnknownRelease), errors.Is(err, release.ErrReleaseExists), errors.Is(err, release.ErrNoRollback),
+		errors.Is(err, history.ErrUnknownDeploy), errors.Is(err, aws.ErrInvalidAccess), errors.Is(err, errUsage):
+		return exitUsage
+	}
+	return exitBuildFailed
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  build        build the site to the output directory and publish it to the target (default)")
+	fmt.Fprintln(out, "  plan         show what a deploy would add, change, leave unchanged or delete without uploading")
+	fmt.Fprintln(out, "  deploy       publish a build output directory exactly as it was built, see -from")
+	fmt.Fprintln(out, "  rollback     switch back to the release before the active one, or to -release-id")
+	fmt.Fprintln(out, "  releases     list the retained releases, or with -prune delete all but the -keep newest")
+	fmt.Fprintln(out, "  history      list past deploys, see -key, or show what changed between two: history <id> <id>")
+	fmt.Fprintln(out, "  init-bucket  create the bucket of an s3 target and set it up for website hosting, see bucket in the config")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
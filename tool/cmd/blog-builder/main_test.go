@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/aws"
+	"github.com/rmarken5/blog-builder/tool/logic/build"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/history"
+	"github.com/rmarken5/blog-builder/tool/logic/release"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setFlags sets command line flags for the rest of the test.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	for name, value := range values {
+		previous := flag.Lookup(name).Value.String()
+		require.NoError(t, flag.Set(name, value))
+		t.Cleanup(func() { flag.Set(name, previous) })
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	fromFile := config.Default()
+	fromFile.Deploy.Target = "s3://from-file/"
+	fromFile.Deploy.Prefix = "blog/"
+	fromFile.S3.Endpoint = "http://minio:9000"
+
+	t.Run("should keep the config file without flags", func(t *testing.T) {
+		assert.Equal(t, fromFile, applyFlags(fromFile))
+	})
+
+	t.Run("should override the config file with the flags given", func(t *testing.T) {
+		setFlags(t, map[string]string{
+			"target":            "file:///srv/www",
+			"region":            "eu-west-1",
+			"path-style":        "true",
+			"profile":           "blog",
+			"compress":          "gzip",
+			"concurrency":       "2",
+			"keep":              "0",
+			"releases":          "true",
+			"wait-invalidation": "true",
+		})
+
+		merged := applyFlags(fromFile)
+		assert.Equal(t, "file:///srv/www", merged.Deploy.Target)
+		assert.Equal(t, config.S3{Region: "eu-west-1", Endpoint: "http://minio:9000", PathStyle: true, Profile: "blog"}, merged.S3)
+		assert.Equal(t, "gzip", merged.Deploy.Compression)
+		assert.Equal(t, 2, merged.Deploy.Concurrency)
+		assert.Equal(t, config.Releases{Enabled: true, Keep: 0}, merged.Deploy.Releases)
+		assert.True(t, merged.CloudFront.Wait)
+		assert.Equal(t, fromFile.Deploy.MaxAttempts, merged.Deploy.MaxAttempts)
+	})
+
+	t.Run("should build the target from the bucket name and the prefix of the config file", func(t *testing.T) {
+		setFlags(t, map[string]string{"bucket-name": "my-blog"})
+		assert.Equal(t, "s3://my-blog/blog/", applyFlags(fromFile).Deploy.Target)
+
+		setFlags(t, map[string]string{"prefix": "site"})
+		assert.Equal(t, "s3://my-blog/site/", applyFlags(fromFile).Deploy.Target)
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"prune threshold", build.ErrPruneThreshold, exitDeployAborted},
+		{"failed uploads", build.ErrUploadsFailed, exitUploadFailed},
+		{"failed prune", build.ErrPruneFailed, exitUploadFailed},
+		{"s3 upload", aws.ErrUploadFile, exitUploadFailed},
+		{"s3 delete", aws.ErrDeleteFile, exitUploadFailed},
+		{"target write", target.ErrWriteFile, exitUploadFailed},
+		{"target delete", target.ErrDeleteFile, exitUploadFailed},
+		{"invalidation", aws.ErrInvalidation, exitInvalidationFailed},
+		{"bucket setup", aws.ErrBucketSetup, exitBucketSetupFailed},
+		{"unknown release", release.ErrUnknownRelease, exitUsage},
+		{"existing release", release.ErrReleaseExists, exitUsage},
+		{"unknown deploy", history.ErrUnknownDeploy, exitUsage},
+		{"usage", errUsage, exitUsage},
+		{"anything else", errors.New("broken markdown"), exitBuildFailed},
+	}
+	for _, tt := range tests {
+		t.Run("should map "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCode(fmt.Errorf("error writing record: %w - %w", errors.New("cause"), tt.err)))
+		})
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	t.Run("should reject a command after the flags", func(t *testing.T) {
+		assert.ErrorIs(t, checkArgs(commandBuild, []string{"deploy"}), errUsage)
+		assert.ErrorIs(t, checkArgs(commandDeploy, []string{"extra"}), errUsage)
+	})
+
+	t.Run("should leave the deploy ids of history to it", func(t *testing.T) {
+		assert.NoError(t, checkArgs(commandBuild, nil))
+		assert.NoError(t, checkArgs(commandHistory, []string{"a", "b"}))
+	})
+}
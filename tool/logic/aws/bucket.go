@@ -0,0 +1,295 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+const (
+	AccessPublicRead = "public-read"
+	AccessCloudFront = "cloudfront"
+	AccessPrivate    = "private"
+)
+
+var (
+	ErrInvalidAccess = errors.New("invalid bucket access")
+	ErrBucketSetup   = errors.New("error setting up bucket")
+)
+
+const (
+	policyVersion = "2012-10-17"
+	// readStatementID starts the Sid of the statement letting visitors read the site, followed by
+	// the letters and digits of the prefix so every site of a bucket has its own.
+	readStatementID = "BlogBuilderRead"
+	// regionWithoutConstraint is the one region a bucket is created in without a location constraint.
+	regionWithoutConstraint = "us-east-1"
+)
+
+type (
+	// BucketAPI is the part of the s3 client used by Bucket.
+	BucketAPI interface {
+		HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+		CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+		PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+		GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+		PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error)
+		DeleteBucketPolicy(ctx context.Context, params *s3.DeleteBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketPolicyOutput, error)
+		GetBucketWebsite(ctx context.Context, params *s3.GetBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.GetBucketWebsiteOutput, error)
+		PutBucketWebsite(ctx context.Context, params *s3.PutBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error)
+	}
+
+	// Bucket sets up a bucket to host the site below prefix.
+	Bucket struct {
+		client BucketAPI
+		name   string
+		prefix string
+		region string
+	}
+
+	policy struct {
+		Version   string            `json:"Version"`
+		ID        string            `json:"Id,omitempty"`
+		Statement []json.RawMessage `json:"Statement"`
+	}
+
+	statement struct {
+		Sid       string         `json:"Sid"`
+		Effect    string         `json:"Effect"`
+		Principal any            `json:"Principal"`
+		Action    string         `json:"Action"`
+		Resource  string         `json:"Resource"`
+		Condition map[string]any `json:"Condition,omitempty"`
+	}
+)
+
+func NewBucket(client BucketAPI, name, prefix, region string) *Bucket {
+	return &Bucket{
+		client: client,
+		name:   name,
+		prefix: NormalizePrefix(prefix),
+		region: region,
+	}
+}
+
+// Init creates the bucket when it is missing, blocks public access as far as settings.Access
+// allows, lets visitors or the CloudFront distribution read the site and turns on static website
+// hosting. Every step converges on the same state, so running it again changes nothing. Steps an
+// S3 compatible store does not implement, such as public access blocks on MinIO, are skipped
+// with a warning.
+func (b Bucket) Init(ctx context.Context, settings config.Bucket) error {
+	read, err := b.readStatement(settings)
+	if err != nil {
+		return err
+	}
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"create bucket", b.create},
+		{"block public access", func(ctx context.Context) error { return b.blockPublicAccess(ctx, settings) }},
+		{"apply bucket policy", func(ctx context.Context) error { return b.applyPolicy(ctx, read) }},
+		{"configure website", func(ctx context.Context) error { return b.configureWebsite(ctx, settings) }},
+	}
+	for _, step := range steps {
+		err := step.run(ctx)
+		if isNotImplemented(err) {
+			slog.Warn("store does not support this setting, skipping", "bucket", b.name, "step", step.name, "error", err)
+			continue
+		}
+		if err != nil {
+			slog.Error("error setting up bucket", "bucket", b.name, "step", step.name, "error", err)
+			return fmt.Errorf("error during %s of %s: %w - %w", step.name, b.name, err, ErrBucketSetup)
+		}
+	}
+	return nil
+}
+
+func (b Bucket) create(ctx context.Context) error {
+	_, err := b.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(b.name)})
+	var notFound *types.NotFound
+	var noSuchBucket *types.NoSuchBucket
+	if err == nil || !(errors.As(err, &notFound) || errors.As(err, &noSuchBucket)) {
+		return err
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(b.name)}
+	if b.region != "" && b.region != regionWithoutConstraint {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(b.region),
+		}
+	}
+	_, err = b.client.CreateBucket(ctx, input)
+	var ownedByYou *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &ownedByYou) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("created bucket", "bucket", b.name, "region", b.region)
+	return nil
+}
+
+// blockPublicAccess always blocks public ACLs when settings ask for it. Public policies are only
+// allowed when the site is served straight from the bucket.
+func (b Bucket) blockPublicAccess(ctx context.Context, settings config.Bucket) error {
+	publicPolicy := settings.Access == AccessPublicRead
+	_, err := b.client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(b.name),
+		PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(settings.BlockPublicACLs),
+			IgnorePublicAcls:      aws.Bool(settings.BlockPublicACLs),
+			BlockPublicPolicy:     aws.Bool(!publicPolicy),
+			RestrictPublicBuckets: aws.Bool(!publicPolicy),
+		},
+	})
+	return err
+}
+
+// applyPolicy replaces the read statement of the site in the bucket policy with read, or removes
+// it when read is nil. Statements for anything else are kept.
+func (b Bucket) applyPolicy(ctx context.Context, read *statement) error {
+	current, err := b.policy(ctx)
+	if err != nil {
+		return err
+	}
+
+	updated := policy{Version: policyVersion, ID: current.ID, Statement: make([]json.RawMessage, 0, len(current.Statement)+1)}
+	if current.Version != "" {
+		updated.Version = current.Version
+	}
+	for _, raw := range current.Statement {
+		var existing statement
+		if err := json.Unmarshal(raw, &existing); err != nil || existing.Sid != b.readStatementID() {
+			updated.Statement = append(updated.Statement, raw)
+		}
+	}
+	if read != nil {
+		raw, err := json.Marshal(read)
+		if err != nil {
+			return err
+		}
+		updated.Statement = append(updated.Statement, raw)
+	}
+
+	if len(updated.Statement) == 0 {
+		if len(current.Statement) == 0 {
+			return nil
+		}
+		_, err := b.client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(b.name)})
+		return err
+	}
+	document, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(b.name),
+		Policy: aws.String(string(document)),
+	})
+	return err
+}
+
+// policy returns the current bucket policy, which is empty when the bucket has none.
+func (b Bucket) policy(ctx context.Context) (policy, error) {
+	output, err := b.client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(b.name)})
+	if apiErrorCode(err) == "NoSuchBucketPolicy" {
+		return policy{}, nil
+	}
+	if err != nil {
+		return policy{}, err
+	}
+	var current policy
+	if err := json.Unmarshal([]byte(aws.ToString(output.Policy)), &current); err != nil {
+		return policy{}, fmt.Errorf("error decoding policy of bucket %s: %w", b.name, err)
+	}
+	return current, nil
+}
+
+// readStatement returns the policy statement that lets the readers settings allow get the
+// objects of the site, or nil for a private site.
+func (b Bucket) readStatement(settings config.Bucket) (*statement, error) {
+	read := &statement{
+		Sid:      b.readStatementID(),
+		Effect:   "Allow",
+		Action:   "s3:GetObject",
+		Resource: "arn:aws:s3:::" + b.name + "/" + b.prefix + "*",
+	}
+	switch settings.Access {
+	case AccessPublicRead:
+		read.Principal = "*"
+	case AccessCloudFront:
+		if settings.DistributionARN == "" {
+			return nil, fmt.Errorf("access %s needs bucket.distribution_arn: %w", AccessCloudFront, ErrInvalidAccess)
+		}
+		read.Principal = map[string]string{"Service": "cloudfront.amazonaws.com"}
+		read.Condition = map[string]any{
+			"StringEquals": map[string]string{"AWS:SourceArn": settings.DistributionARN},
+		}
+	case AccessPrivate:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%q, expected %s, %s or %s: %w", settings.Access, AccessPublicRead, AccessCloudFront, AccessPrivate, ErrInvalidAccess)
+	}
+	return read, nil
+}
+
+func (b Bucket) readStatementID() string {
+	var id strings.Builder
+	id.WriteString(readStatementID)
+	for _, r := range b.prefix {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			id.WriteRune(r)
+		}
+	}
+	return id.String()
+}
+
+// configureWebsite sets the index and error documents of the bucket website. The routing rules
+// are kept, they route the sites of the bucket to their active releases.
+func (b Bucket) configureWebsite(ctx context.Context, settings config.Bucket) error {
+	var rules []types.RoutingRule
+	website, err := b.client.GetBucketWebsite(ctx, &s3.GetBucketWebsiteInput{Bucket: aws.String(b.name)})
+	switch {
+	case err == nil:
+		rules = website.RoutingRules
+	case apiErrorCode(err) != "NoSuchWebsiteConfiguration":
+		return err
+	}
+
+	configuration := &types.WebsiteConfiguration{
+		IndexDocument: &types.IndexDocument{Suffix: aws.String(settings.IndexDocument)},
+		RoutingRules:  rules,
+	}
+	if settings.ErrorDocument != "" {
+		configuration.ErrorDocument = &types.ErrorDocument{Key: aws.String(b.prefix + settings.ErrorDocument)}
+	}
+	_, err = b.client.PutBucketWebsite(ctx, &s3.PutBucketWebsiteInput{
+		Bucket:               aws.String(b.name),
+		WebsiteConfiguration: configuration,
+	})
+	return err
+}
+
+func apiErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func isNotImplemented(err error) bool {
+	return apiErrorCode(err) == "NotImplemented"
+}
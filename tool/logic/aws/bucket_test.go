@@ -0,0 +1,169 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBucket is a single bucket that stores what it is configured with. Calls named in
+// notImplemented fail the way MinIO does for settings it does not support.
+type fakeBucket struct {
+	fakeS3
+	exists         bool
+	created        []*s3.CreateBucketInput
+	accessBlock    *types.PublicAccessBlockConfiguration
+	policy         string
+	notImplemented map[string]bool
+}
+
+func (f *fakeBucket) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !f.exists {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeBucket) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	f.created = append(f.created, params)
+	f.exists = true
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (f *fakeBucket) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	if f.notImplemented["PutPublicAccessBlock"] {
+		return nil, &smithy.GenericAPIError{Code: "NotImplemented"}
+	}
+	f.accessBlock = params.PublicAccessBlockConfiguration
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (f *fakeBucket) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	if f.policy == "" {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchBucketPolicy"}
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(f.policy)}, nil
+}
+
+func (f *fakeBucket) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	f.policy = aws.ToString(params.Policy)
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+func (f *fakeBucket) DeleteBucketPolicy(ctx context.Context, params *s3.DeleteBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketPolicyOutput, error) {
+	f.policy = ""
+	return &s3.DeleteBucketPolicyOutput{}, nil
+}
+
+// statements decodes the statements of the bucket policy.
+func (f *fakeBucket) statements(t *testing.T) []map[string]any {
+	var document struct {
+		Statement []map[string]any
+	}
+	require.NoError(t, json.Unmarshal([]byte(f.policy), &document))
+	return document.Statement
+}
+
+func TestBucket_Init(t *testing.T) {
+	ctx := context.Background()
+	settings := config.Bucket{IndexDocument: "index.html", ErrorDocument: "404.html", Access: AccessPublicRead, BlockPublicACLs: true}
+
+	t.Run("should create a public website bucket and change nothing when run again", func(t *testing.T) {
+		api := &fakeBucket{}
+		bucket := NewBucket(api, "my-blog", "", "us-east-2")
+		require.NoError(t, bucket.Init(ctx, settings))
+
+		require.Len(t, api.created, 1)
+		assert.Equal(t, types.BucketLocationConstraint("us-east-2"), api.created[0].CreateBucketConfiguration.LocationConstraint)
+		assert.Equal(t, &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(false),
+			RestrictPublicBuckets: aws.Bool(false),
+		}, api.accessBlock)
+		assert.Equal(t, []map[string]any{{
+			"Sid":       "BlogBuilderRead",
+			"Effect":    "Allow",
+			"Principal": "*",
+			"Action":    "s3:GetObject",
+			"Resource":  "arn:aws:s3:::my-blog/*",
+		}}, api.statements(t))
+		assert.Equal(t, "index.html", aws.ToString(api.website.IndexDocument.Suffix))
+		assert.Equal(t, "404.html", aws.ToString(api.website.ErrorDocument.Key))
+
+		policy, website := api.policy, api.website
+		require.NoError(t, bucket.Init(ctx, settings))
+		assert.Len(t, api.created, 1)
+		assert.Equal(t, policy, api.policy)
+		assert.Equal(t, website, api.website)
+	})
+
+	t.Run("should only let the distribution read the site and keep other statements and routing rules", func(t *testing.T) {
+		rule := types.RoutingRule{
+			Condition: &types.Condition{KeyPrefixEquals: aws.String("blog/"), HttpErrorCodeReturnedEquals: aws.String("404")},
+			Redirect:  &types.Redirect{ReplaceKeyPrefixWith: aws.String("blog/releases/a/")},
+		}
+		api := &fakeBucket{
+			exists: true,
+			policy: `{"Version":"2012-10-17","Statement":[{"Sid":"Logs","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::my-blog/logs/*"}]}`,
+			fakeS3: fakeS3{website: &types.WebsiteConfiguration{RoutingRules: []types.RoutingRule{rule}}},
+		}
+		cdn := settings
+		cdn.Access = AccessCloudFront
+		cdn.DistributionARN = "arn:aws:cloudfront::123456789012:distribution/E123"
+
+		require.NoError(t, NewBucket(api, "my-blog", "blog", "us-east-1").Init(ctx, cdn))
+		assert.Empty(t, api.created)
+		assert.True(t, aws.ToBool(api.accessBlock.BlockPublicPolicy))
+		assert.True(t, aws.ToBool(api.accessBlock.RestrictPublicBuckets))
+
+		statements := api.statements(t)
+		require.Len(t, statements, 2)
+		assert.Equal(t, "Logs", statements[0]["Sid"])
+		assert.Equal(t, "BlogBuilderReadblog", statements[1]["Sid"])
+		assert.Equal(t, map[string]any{"Service": "cloudfront.amazonaws.com"}, statements[1]["Principal"])
+		assert.Equal(t, "arn:aws:s3:::my-blog/blog/*", statements[1]["Resource"])
+		assert.Equal(t, map[string]any{"StringEquals": map[string]any{"AWS:SourceArn": cdn.DistributionARN}}, statements[1]["Condition"])
+
+		assert.Equal(t, []types.RoutingRule{rule}, api.website.RoutingRules)
+		assert.Equal(t, "blog/404.html", aws.ToString(api.website.ErrorDocument.Key))
+	})
+
+	t.Run("should drop the read statement of a private site", func(t *testing.T) {
+		api := &fakeBucket{exists: true}
+		bucket := NewBucket(api, "my-blog", "", "us-east-1")
+		require.NoError(t, bucket.Init(ctx, settings))
+		require.NotEmpty(t, api.policy)
+
+		private := settings
+		private.Access = AccessPrivate
+		require.NoError(t, bucket.Init(ctx, private))
+		assert.Empty(t, api.policy)
+	})
+
+	t.Run("should skip settings the store does not implement", func(t *testing.T) {
+		api := &fakeBucket{notImplemented: map[string]bool{"PutPublicAccessBlock": true}}
+		require.NoError(t, NewBucket(api, "my-blog", "", "us-east-1").Init(ctx, settings))
+		assert.Nil(t, api.created[0].CreateBucketConfiguration)
+		assert.Nil(t, api.accessBlock)
+		assert.NotEmpty(t, api.policy)
+	})
+
+	t.Run("should reject unknown access and a cloudfront site without a distribution", func(t *testing.T) {
+		api := &fakeBucket{}
+		invalid := settings
+		invalid.Access = "public"
+		assert.ErrorIs(t, NewBucket(api, "my-blog", "", "").Init(ctx, invalid), ErrInvalidAccess)
+		invalid.Access = AccessCloudFront
+		assert.ErrorIs(t, NewBucket(api, "my-blog", "", "").Init(ctx, invalid), ErrInvalidAccess)
+		assert.Empty(t, api.created)
+	})
+}
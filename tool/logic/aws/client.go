@@ -1,70 +1,208 @@
 package aws
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var (
 	ErrUploadFile = errors.New("error uploading file to s3")
+	ErrDeleteFile = errors.New("error deleting file from s3")
+)
+
+const (
+	// maxDeleteKeys is the most keys a single DeleteObjects request accepts.
+	maxDeleteKeys = 1000
+	// metadataMD5 is the user metadata key holding the hex md5 of an uploaded object.
+	metadataMD5 = "md5"
 )
 
 type (
-	S3Client interface {
-		GetBucketHashes(ctx context.Context) (map[string]string, error)
-		WriteFileToBucket(ctx context.Context, key string, contentType string, file io.Reader) error
+	// S3API is the part of the s3 client used by Client.
+	S3API interface {
+		s3.ListObjectsV2APIClient
+		HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+		GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+		PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+		DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+		GetBucketWebsite(ctx context.Context, params *s3.GetBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.GetBucketWebsiteOutput, error)
+		PutBucketWebsite(ctx context.Context, params *s3.PutBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error)
+	}
+	// ObjectOptions are the headers, storage class and user metadata an object is written with.
+	// Empty fields are left to the defaults of the store. WebsiteRedirectLocation turns the object
+	// into a redirect to a path of the site or an absolute url.
+	ObjectOptions struct {
+		ContentType             string
+		CacheControl            string
+		ContentDisposition      string
+		ContentEncoding         string
+		StorageClass            string
+		WebsiteRedirectLocation string
+		Metadata                map[string]string
 	}
+
+	// Client reads and writes the site below prefix in bucket. Keys passed to and returned
+	// from its methods are relative to the prefix.
 	Client struct {
-		client *s3.Client
+		client S3API
 		bucket string
+		prefix string
+		retry  RetryPolicy
 	}
 )
 
-func New(client *s3.Client, bucket string) *Client {
+func New(client S3API, bucket, prefix string, retry RetryPolicy) *Client {
 	return &Client{
 		client: client,
 		bucket: bucket,
+		prefix: NormalizePrefix(prefix),
+		retry:  retry,
+	}
+}
+
+// singleAttempt turns off the sdk retryer for a request that RetryPolicy already retries.
+func singleAttempt(o *s3.Options) {
+	o.RetryMaxAttempts = 1
+}
+
+// NormalizePrefix trims leading slashes from prefix and makes sure a non empty prefix ends in one.
+func NormalizePrefix(prefix string) string {
+	prefix = strings.TrimLeft(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
 	}
+	return prefix
 }
 
-func (c Client) GetBucketHashes(ctx context.Context) (map[string]string, error) {
+// GetHashes returns the md5 of every object in the bucket. The hash is taken from the ETag of the
+// listing when it is a plain md5, then from the md5 metadata written by WriteFile, and only
+// when neither is usable by downloading and hashing the object. Under SSE-KMS or SSE-C the ETag
+// is 32 hex digits that are not the md5, so every object of such a bucket looks changed.
+func (c Client) GetHashes(ctx context.Context) (map[string]string, error) {
+	return c.HashPrefix(ctx, "")
+}
+
+// HashPrefix returns the md5 of the objects whose key starts with prefix, the same way as
+// GetHashes but listing only those objects.
+func (c Client) HashPrefix(ctx context.Context, prefix string) (map[string]string, error) {
 	hashes := make(map[string]string)
-	objectList, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(c.bucket)})
-	if err != nil {
-		slog.Error("error listing objects", "error", err)
-		return nil, err
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(c.bucket)}
+	if c.prefix+prefix != "" {
+		input.Prefix = aws.String(c.prefix + prefix)
 	}
 
-	for _, object := range objectList.Contents {
-		key := *object.Key
-		if key[len(key)-1:] == "/" {
-			continue
-		}
-		getObject, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: object.Key})
+	paginator := s3.NewListObjectsV2Paginator(c.client, input)
+	for paginator.HasMorePages() {
+		objectList, err := paginator.NextPage(ctx)
 		if err != nil {
-			slog.Error("error getting object", "error", err, "bucket", c.bucket, "key", key)
+			slog.Error("error listing objects", "error", err)
 			return nil, err
 		}
 
-		hash, err := calcMD5(getObject.Body)
-		getObject.Body.Close()
-		if err != nil {
-			slog.Error("error generating hash for object", "error", err, "bucket", c.bucket, "key", key)
+		for _, object := range objectList.Contents {
+			objectKey := aws.ToString(object.Key)
+			key := strings.TrimPrefix(objectKey, c.prefix)
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+			if hash, ok := hashFromETag(aws.ToString(object.ETag)); ok {
+				hashes[key] = hash
+				continue
+			}
+
+			hash, err := c.hashFromMetadata(ctx, objectKey)
+			if err != nil {
+				return nil, err
+			}
+			if hash == "" {
+				slog.Info("no usable etag or metadata, downloading object to hash it", "key", objectKey)
+				hash, err = c.hashFromBody(ctx, objectKey)
+				if err != nil {
+					return nil, err
+				}
+			}
+			hashes[key] = hash
 		}
-		hashes[*object.Key] = hash
 	}
 
 	return hashes, nil
 }
 
+// ListKeys returns the keys below prefix in listing order, without looking at the objects
+// themselves.
+func (c Client) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	paginator := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(c.prefix + prefix),
+	})
+	for paginator.HasMorePages() {
+		objectList, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("error listing objects", "prefix", c.prefix+prefix, "error", err)
+			return nil, err
+		}
+		for _, object := range objectList.Contents {
+			key := strings.TrimPrefix(aws.ToString(object.Key), c.prefix)
+			if key != "" && !strings.HasSuffix(key, "/") {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// hashFromETag returns the md5 held in etag. Objects uploaded in multiple parts have an ETag of
+// the form "<hash>-<parts>" that is not the md5 of the object, and are reported as unusable.
+func hashFromETag(etag string) (string, bool) {
+	hash := strings.ToLower(strings.Trim(etag, `"`))
+	if len(hash) != md5.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+func (c Client) hashFromMetadata(ctx context.Context, key string) (string, error) {
+	headObject, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(key)})
+	if err != nil {
+		slog.Error("error getting object metadata", "error", err, "bucket", c.bucket, "key", key)
+		return "", err
+	}
+	hash, _ := hashFromETag(headObject.Metadata[metadataMD5])
+	return hash, nil
+}
+
+func (c Client) hashFromBody(ctx context.Context, key string) (string, error) {
+	getObject, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(key)})
+	if err != nil {
+		slog.Error("error getting object", "error", err, "bucket", c.bucket, "key", key)
+		return "", err
+	}
+	defer getObject.Body.Close()
+
+	hash, err := calcMD5(getObject.Body)
+	if err != nil {
+		slog.Error("error generating hash for object", "error", err, "bucket", c.bucket, "key", key)
+		return "", err
+	}
+	return hash, nil
+}
+
 func calcMD5(r io.Reader) (string, error) {
 	hash := md5.New()
 	if _, err := io.Copy(hash, r); err != nil {
@@ -74,16 +212,110 @@ func calcMD5(r io.Reader) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func (c Client) WriteFileToBucket(ctx context.Context, key string, contentType string, file io.Reader) error {
-	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(c.bucket),
-		Key:         aws.String(key),
-		Body:        file,
-		ContentType: aws.String(contentType),
+// ReadFile downloads key. A missing key is an error wrapping fs.ErrNotExist.
+func (c Client) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	getObject, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(c.prefix + key)})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("error reading %s from s3: %w - %w", key, err, fs.ErrNotExist)
+	}
+	if err != nil {
+		slog.Error("error getting object", "error", err, "bucket", c.bucket, "key", key)
+		return nil, err
+	}
+	defer getObject.Body.Close()
+	return io.ReadAll(getObject.Body)
+}
+
+// WriteFile uploads file to key with opts, storing its md5 as metadata so GetHashes does not
+// need to download it again. With a WebsiteRedirectLocation the bucket website answers a request
+// for key with a redirect, while a CloudFront or REST origin still serves file, which should be a
+// page that redirects by itself. Transient errors are retried, a permanent failure is an *UploadError.
+func (c Client) WriteFile(ctx context.Context, key string, file io.Reader, opts ObjectOptions) error {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		slog.Error("error reading file for upload", "filename", key, "error", err)
+		return &UploadError{Key: key, Err: err}
+	}
+	hash, err := calcMD5(bytes.NewReader(body))
+	if err != nil {
+		return &UploadError{Key: key, Err: err}
+	}
+
+	metadata := make(map[string]string, len(opts.Metadata)+1)
+	for name, value := range opts.Metadata {
+		metadata[name] = value
+	}
+	metadata[metadataMD5] = hash
+
+	var redirectLocation *string
+	if opts.WebsiteRedirectLocation != "" {
+		redirectLocation = aws.String(c.redirectLocation(opts.WebsiteRedirectLocation))
+	}
+
+	attempts, err := c.retry.do(ctx, key, func() error {
+		_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:                  aws.String(c.bucket),
+			Key:                     aws.String(c.prefix + key),
+			Body:                    bytes.NewReader(body),
+			ContentType:             optional(opts.ContentType),
+			CacheControl:            optional(opts.CacheControl),
+			ContentDisposition:      optional(opts.ContentDisposition),
+			ContentEncoding:         optional(opts.ContentEncoding),
+			StorageClass:            types.StorageClass(opts.StorageClass),
+			WebsiteRedirectLocation: redirectLocation,
+			Metadata:                metadata,
+		}, singleAttempt)
+		return err
 	})
 	if err != nil {
-		slog.Error("error uploading file to s3", "filename", key, "error", err)
-		return fmt.Errorf("error writing file %s to s3: %w - %w", key, err, ErrUploadFile)
+		slog.Error("error uploading file to s3", "filename", key, "attempts", attempts, "error", err)
+		return &UploadError{Key: key, Attempts: attempts, Err: err}
+	}
+
+	return nil
+}
+
+// redirectLocation returns location as the bucket website expects it: an absolute url as it is,
+// and a path of the site from the root of the bucket.
+func (c Client) redirectLocation(location string) string {
+	if strings.Contains(location, "://") {
+		return location
+	}
+	return "/" + c.prefix + strings.TrimPrefix(location, "/")
+}
+
+// optional returns nil for an empty value, so the header is left out of the request.
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// DeleteFiles deletes keys from the bucket in batches of at most 1000 keys.
+func (c Client) DeleteFiles(ctx context.Context, keys []string) error {
+	for start := 0; start < len(keys); start += maxDeleteKeys {
+		end := min(start+maxDeleteKeys, len(keys))
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(c.prefix + key)})
+		}
+
+		output, err := c.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(c.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			slog.Error("error deleting files from s3", "count", len(objects), "error", err)
+			return fmt.Errorf("error deleting %d files from s3: %w - %w", len(objects), err, ErrDeleteFile)
+		}
+		if len(output.Errors) > 0 {
+			for _, deleteErr := range output.Errors {
+				slog.Error("error deleting file from s3", "filename", aws.ToString(deleteErr.Key), "error", aws.ToString(deleteErr.Message))
+			}
+			return fmt.Errorf("error deleting %d of %d files from s3: %w", len(output.Errors), len(objects), ErrDeleteFile)
+		}
 	}
 
 	return nil
@@ -0,0 +1,323 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in memory bucket that lists pageSize keys per page.
+type fakeS3 struct {
+	objects  map[string]fakeObject
+	order    []string
+	pageSize int
+	gets     []string
+	puts     []*s3.PutObjectInput
+	putErrs  []error
+	deletes  []string
+	website  *types.WebsiteConfiguration
+}
+
+type fakeObject struct {
+	etag     string
+	metadata map[string]string
+	body     string
+	bodyErr  error
+}
+
+func (f *fakeS3) add(key string, object fakeObject) {
+	if f.objects == nil {
+		f.objects = make(map[string]fakeObject)
+	}
+	f.objects[key] = object
+	f.order = append(f.order, key)
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	keys := make([]string, 0)
+	for _, key := range f.order {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	start, _ := strconv.Atoi(aws.ToString(params.ContinuationToken))
+	end := min(start+f.pageSize, len(keys))
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(keys))}
+	if end < len(keys) {
+		output.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	for _, key := range keys[start:end] {
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key), ETag: aws.String(f.objects[key].etag)})
+	}
+	return output, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	object, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{Metadata: object.metadata}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.gets = append(f.gets, aws.ToString(params.Key))
+	if err := f.objects[aws.ToString(params.Key)].bodyErr; err != nil {
+		return &s3.GetObjectOutput{Body: io.NopCloser(iotest.ErrReader(err))}, nil
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(f.objects[aws.ToString(params.Key)].body))}, nil
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.puts = append(f.puts, params)
+	if len(f.putErrs) > 0 {
+		err := f.putErrs[0]
+		f.putErrs = f.putErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	for _, object := range params.Delete.Objects {
+		f.deletes = append(f.deletes, aws.ToString(object.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) GetBucketWebsite(ctx context.Context, params *s3.GetBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.GetBucketWebsiteOutput, error) {
+	if f.website == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchWebsiteConfiguration"}
+	}
+	return &s3.GetBucketWebsiteOutput{
+		IndexDocument: f.website.IndexDocument,
+		ErrorDocument: f.website.ErrorDocument,
+		RoutingRules:  f.website.RoutingRules,
+	}, nil
+}
+
+func (f *fakeS3) PutBucketWebsite(ctx context.Context, params *s3.PutBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error) {
+	f.website = params.WebsiteConfiguration
+	return &s3.PutBucketWebsiteOutput{}, nil
+}
+
+const (
+	emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+	helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+)
+
+func TestClient_GetHashes(t *testing.T) {
+	t.Run("should follow every page of the listing", func(t *testing.T) {
+		api := &fakeS3{pageSize: 2}
+		for i := 0; i < 5; i++ {
+			api.add("post-"+strconv.Itoa(i)+".html", fakeObject{etag: `"` + emptyMD5 + `"`})
+		}
+
+		hashes, err := New(api, "bucket", "", RetryPolicy{}).GetHashes(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, hashes, 5)
+		assert.Equal(t, emptyMD5, hashes["post-4.html"])
+	})
+
+	t.Run("should only list below the prefix and return keys relative to it", func(t *testing.T) {
+		api := &fakeS3{pageSize: 10}
+		api.add("blog/index.html", fakeObject{etag: emptyMD5})
+		api.add("blog/", fakeObject{etag: emptyMD5})
+		api.add("other/index.html", fakeObject{etag: emptyMD5})
+
+		hashes, err := New(api, "bucket", "/blog", RetryPolicy{}).GetHashes(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"index.html": emptyMD5}, hashes)
+	})
+
+	t.Run("should fall back to metadata and then to the body", func(t *testing.T) {
+		api := &fakeS3{pageSize: 10}
+		api.add("multipart.zip", fakeObject{etag: `"abc-2"`, metadata: map[string]string{metadataMD5: helloMD5}})
+		api.add("legacy.zip", fakeObject{etag: `"abc-2"`, body: "hello"})
+
+		hashes, err := New(api, "bucket", "", RetryPolicy{}).GetHashes(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"multipart.zip": helloMD5, "legacy.zip": helloMD5}, hashes)
+		assert.Equal(t, []string{"legacy.zip"}, api.gets)
+	})
+
+	t.Run("should fail when an object cannot be downloaded to hash it", func(t *testing.T) {
+		errReset := errors.New("connection reset")
+		api := &fakeS3{pageSize: 10}
+		api.add("legacy.zip", fakeObject{etag: `"abc-2"`, bodyErr: errReset})
+
+		_, err := New(api, "bucket", "", RetryPolicy{}).GetHashes(context.Background())
+		assert.ErrorIs(t, err, errReset)
+	})
+
+	t.Run("should only list and hash the objects below a prefix of the site", func(t *testing.T) {
+		api := &fakeS3{pageSize: 10}
+		api.add("blog/releases/a/index.html", fakeObject{etag: `"abc-2"`, body: "hello"})
+		api.add("blog/releases/b/index.html", fakeObject{etag: `"abc-2"`, body: "hello"})
+		api.add("blog/.deploys/a.json", fakeObject{etag: `"abc-2"`, body: "hello"})
+
+		hashes, err := New(api, "bucket", "blog", RetryPolicy{}).HashPrefix(context.Background(), "releases/b/")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"releases/b/index.html": helloMD5}, hashes)
+		assert.Equal(t, []string{"blog/releases/b/index.html"}, api.gets)
+	})
+}
+
+func TestClient_ListKeys(t *testing.T) {
+	api := &fakeS3{pageSize: 2}
+	for _, key := range []string{"blog/index.html", "blog/.deploys/", "blog/.deploys/a.json", "blog/.deploys/b.json", "blog/.deploys/c.json", "other/.deploys/d.json"} {
+		api.add(key, fakeObject{etag: `"abc-2"`})
+	}
+
+	keys, err := New(api, "bucket", "blog", RetryPolicy{}).ListKeys(context.Background(), ".deploys/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{".deploys/a.json", ".deploys/b.json", ".deploys/c.json"}, keys)
+	assert.Empty(t, api.gets, "listing never downloads an object")
+}
+
+func TestClient_WriteFile(t *testing.T) {
+	t.Run("should write below the prefix with the md5 as metadata", func(t *testing.T) {
+		api := &fakeS3{}
+		err := New(api, "bucket", "blog/", RetryPolicy{}).WriteFile(context.Background(), "index.html", bytes.NewReader([]byte("hello")), ObjectOptions{ContentType: "text/html"})
+		require.NoError(t, err)
+		require.Len(t, api.puts, 1)
+		assert.Equal(t, "blog/index.html", aws.ToString(api.puts[0].Key))
+		assert.Equal(t, helloMD5, api.puts[0].Metadata[metadataMD5])
+		assert.Nil(t, api.puts[0].CacheControl)
+	})
+
+	t.Run("should send the headers, storage class and metadata of the options", func(t *testing.T) {
+		api := &fakeS3{}
+		opts := ObjectOptions{
+			ContentType:        "application/pdf",
+			CacheControl:       "max-age=60",
+			ContentDisposition: "attachment",
+			StorageClass:       "STANDARD_IA",
+			Metadata:           map[string]string{"owner": "blog", metadataMD5: "forged"},
+		}
+		err := New(api, "bucket", "", RetryPolicy{}).WriteFile(context.Background(), "book.pdf", strings.NewReader("hello"), opts)
+		require.NoError(t, err)
+		require.Len(t, api.puts, 1)
+		put := api.puts[0]
+		assert.Equal(t, "application/pdf", aws.ToString(put.ContentType))
+		assert.Equal(t, "max-age=60", aws.ToString(put.CacheControl))
+		assert.Equal(t, "attachment", aws.ToString(put.ContentDisposition))
+		assert.Nil(t, put.ContentEncoding)
+		assert.Equal(t, types.StorageClassStandardIa, put.StorageClass)
+		assert.Equal(t, map[string]string{"owner": "blog", metadataMD5: helloMD5}, put.Metadata)
+	})
+
+	t.Run("should upload a redirect with the page that redirects without the website endpoint", func(t *testing.T) {
+		api := &fakeS3{}
+		client := New(api, "bucket", "blog", RetryPolicy{})
+		require.NoError(t, client.WriteFile(context.Background(), "old.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html", WebsiteRedirectLocation: "posts/new.html"}))
+		require.NoError(t, client.WriteFile(context.Background(), "gone.html", strings.NewReader("hello"), ObjectOptions{WebsiteRedirectLocation: "https://example.com/"}))
+		require.Len(t, api.puts, 2)
+
+		body, err := io.ReadAll(api.puts[0].Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, "/blog/posts/new.html", aws.ToString(api.puts[0].WebsiteRedirectLocation))
+		assert.Equal(t, helloMD5, api.puts[0].Metadata[metadataMD5])
+		assert.Equal(t, "https://example.com/", aws.ToString(api.puts[1].WebsiteRedirectLocation))
+	})
+}
+
+// transientError is retryable in the same way as a throttled or unavailable response.
+type transientError struct{}
+
+func (transientError) Error() string        { return "slow down" }
+func (transientError) RetryableError() bool { return true }
+
+func TestClient_WriteFile_retries(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	t.Run("should retry transient errors until the upload succeeds", func(t *testing.T) {
+		api := &fakeS3{putErrs: []error{transientError{}, transientError{}}}
+		err := New(api, "bucket", "", policy).WriteFile(context.Background(), "index.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"})
+		require.NoError(t, err)
+		assert.Len(t, api.puts, 3)
+	})
+
+	t.Run("should give up after the last attempt with an upload error", func(t *testing.T) {
+		api := &fakeS3{putErrs: []error{transientError{}, transientError{}, transientError{}}}
+		err := New(api, "bucket", "", policy).WriteFile(context.Background(), "index.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"})
+
+		var uploadErr *UploadError
+		require.ErrorAs(t, err, &uploadErr)
+		assert.Equal(t, "index.html", uploadErr.Key)
+		assert.Equal(t, 3, uploadErr.Attempts)
+		assert.ErrorIs(t, err, ErrUploadFile)
+		assert.ErrorIs(t, err, transientError{})
+	})
+
+	t.Run("should not retry permanent errors", func(t *testing.T) {
+		errDenied := errors.New("access denied")
+		api := &fakeS3{putErrs: []error{errDenied}}
+		err := New(api, "bucket", "", policy).WriteFile(context.Background(), "index.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"})
+		assert.ErrorIs(t, err, errDenied)
+		assert.Len(t, api.puts, 1)
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	t.Run("should stay below the doubled base delay and the max delay", func(t *testing.T) {
+		policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+		for range 100 {
+			assert.Less(t, policy.backoff(1), 100*time.Millisecond)
+			assert.Less(t, policy.backoff(3), 400*time.Millisecond)
+			assert.Less(t, policy.backoff(60), time.Second)
+		}
+	})
+}
+
+func TestClient_DeleteFiles(t *testing.T) {
+	t.Run("should delete below the prefix in batches", func(t *testing.T) {
+		api := &fakeS3{}
+		keys := make([]string, maxDeleteKeys+1)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+		require.NoError(t, New(api, "bucket", "blog", RetryPolicy{}).DeleteFiles(context.Background(), keys))
+		assert.Len(t, api.deletes, maxDeleteKeys+1)
+		assert.Equal(t, "blog/0", api.deletes[0])
+	})
+}
+
+func TestHashFromETag(t *testing.T) {
+	tests := []struct {
+		name   string
+		etag   string
+		want   string
+		wantOK bool
+	}{
+		{name: "should unquote a single part etag", etag: `"d41d8cd98f00b204e9800998ecf8427e"`, want: "d41d8cd98f00b204e9800998ecf8427e", wantOK: true},
+		{name: "should lowercase the hash", etag: "D41D8CD98F00B204E9800998ECF8427E", want: "d41d8cd98f00b204e9800998ecf8427e", wantOK: true},
+		{name: "should reject a multipart etag", etag: `"9b2cf535f27731c974343645a3985328-3"`},
+		{name: "should reject a non hex etag", etag: `"zz1d8cd98f00b204e9800998ecf8427e"`},
+		{name: "should reject an empty etag", etag: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, ok := hashFromETag(tt.etag)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, hash)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+var ErrInvalidation = errors.New("error invalidating cloudfront cache")
+
+// indexDocumentName is served for a directory path such as /posts/, which is cached under that path.
+const indexDocumentName = "index.html"
+
+type (
+	// CloudFrontAPI is the part of the cloudfront client used by CDN.
+	CloudFrontAPI interface {
+		cloudfront.GetInvalidationAPIClient
+		CreateInvalidation(ctx context.Context, params *cloudfront.CreateInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.CreateInvalidationOutput, error)
+	}
+
+	// CDN invalidates cached paths of a CloudFront distribution.
+	CDN struct {
+		client         CloudFrontAPI
+		distributionID string
+	}
+)
+
+func NewCDN(client CloudFrontAPI, distributionID string) *CDN {
+	return &CDN{
+		client:         client,
+		distributionID: distributionID,
+	}
+}
+
+// Invalidate creates an invalidation for paths and returns its id.
+func (c CDN) Invalidate(ctx context.Context, paths []string) (string, error) {
+	output, err := c.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(c.distributionID),
+		InvalidationBatch: &types.InvalidationBatch{
+			// the caller reference only has to be unique per invalidation
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &types.Paths{
+				Items:    paths,
+				Quantity: aws.Int32(int32(len(paths))),
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("error creating invalidation", "distribution", c.distributionID, "error", err)
+		return "", fmt.Errorf("error invalidating %d paths of distribution %s: %w - %w", len(paths), c.distributionID, err, ErrInvalidation)
+	}
+	return aws.ToString(output.Invalidation.Id), nil
+}
+
+// Wait blocks until invalidation id has completed or timeout has passed.
+func (c CDN) Wait(ctx context.Context, id string, timeout time.Duration, optFns ...func(*cloudfront.InvalidationCompletedWaiterOptions)) error {
+	waiter := cloudfront.NewInvalidationCompletedWaiter(c.client, optFns...)
+	err := waiter.Wait(ctx, &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(c.distributionID),
+		Id:             aws.String(id),
+	}, timeout)
+	if err != nil {
+		return fmt.Errorf("error waiting for invalidation %s: %w - %w", id, err, ErrInvalidation)
+	}
+	return nil
+}
+
+// InvalidationPaths returns the cloudfront paths to invalidate for the changed keys. An index.html
+// also invalidates the directory path it is served under. When there are more than maxPaths
+// paths, the deepest directories collapse to wildcards one level at a time until few enough are
+// left, ending with /* for everything.
+func InvalidationPaths(keys []string, maxPaths int) []string {
+	paths := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		escaped := escapePath(key)
+		paths["/"+escaped] = true
+		if path.Base(key) == indexDocumentName {
+			paths["/"+strings.TrimSuffix(escaped, indexDocumentName)] = true
+		}
+	}
+
+	depth := 0
+	for p := range paths {
+		depth = max(depth, strings.Count(p, "/")-1)
+	}
+	for ; len(paths) > maxPaths && depth > 0; depth-- {
+		paths = collapse(paths, depth)
+	}
+	if len(paths) > maxPaths {
+		return []string{"/*"}
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// collapse replaces every path below depth directories with a wildcard for its directory at that depth.
+func collapse(paths map[string]bool, depth int) map[string]bool {
+	collapsed := make(map[string]bool, len(paths))
+	for p := range paths {
+		segments := strings.Split(strings.TrimPrefix(p, "/"), "/")
+		if len(segments) > depth {
+			p = "/" + strings.Join(segments[:depth], "/") + "/*"
+		}
+		collapsed[p] = true
+	}
+	return collapsed
+}
+
+// escapePath url encodes each segment of key, as cloudfront expects.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
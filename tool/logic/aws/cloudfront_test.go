@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCloudFront records invalidations and completes each one after pending status checks.
+type fakeCloudFront struct {
+	created   []*cloudfront.CreateInvalidationInput
+	createErr error
+	pending   int
+	checks    int
+}
+
+func (f *fakeCloudFront) CreateInvalidation(ctx context.Context, params *cloudfront.CreateInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.CreateInvalidationOutput, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	f.created = append(f.created, params)
+	return &cloudfront.CreateInvalidationOutput{Invalidation: &types.Invalidation{Id: aws.String("I" + strconv.Itoa(len(f.created)))}}, nil
+}
+
+func (f *fakeCloudFront) GetInvalidation(ctx context.Context, params *cloudfront.GetInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetInvalidationOutput, error) {
+	f.checks++
+	status := "InProgress"
+	if f.checks > f.pending {
+		status = "Completed"
+	}
+	return &cloudfront.GetInvalidationOutput{Invalidation: &types.Invalidation{Id: params.Id, Status: aws.String(status)}}, nil
+}
+
+func TestCDN_Invalidate(t *testing.T) {
+	t.Run("should invalidate the paths of the distribution", func(t *testing.T) {
+		api := &fakeCloudFront{}
+		id, err := NewCDN(api, "E123").Invalidate(context.Background(), []string{"/index.html", "/"})
+		require.NoError(t, err)
+		assert.Equal(t, "I1", id)
+
+		require.Len(t, api.created, 1)
+		assert.Equal(t, "E123", aws.ToString(api.created[0].DistributionId))
+		assert.Equal(t, []string{"/index.html", "/"}, api.created[0].InvalidationBatch.Paths.Items)
+		assert.Equal(t, int32(2), aws.ToInt32(api.created[0].InvalidationBatch.Paths.Quantity))
+		assert.NotEmpty(t, aws.ToString(api.created[0].InvalidationBatch.CallerReference))
+	})
+
+	t.Run("should wrap failures", func(t *testing.T) {
+		_, err := NewCDN(&fakeCloudFront{createErr: errors.New("access denied")}, "E123").Invalidate(context.Background(), []string{"/*"})
+		assert.ErrorIs(t, err, ErrInvalidation)
+	})
+}
+
+func TestCDN_Wait(t *testing.T) {
+	fastPolling := func(o *cloudfront.InvalidationCompletedWaiterOptions) {
+		o.MinDelay = time.Millisecond
+		o.MaxDelay = time.Millisecond
+	}
+
+	t.Run("should poll until the invalidation has completed", func(t *testing.T) {
+		api := &fakeCloudFront{pending: 2}
+		require.NoError(t, NewCDN(api, "E123").Wait(context.Background(), "I1", time.Second, fastPolling))
+		assert.Equal(t, 3, api.checks)
+	})
+
+	t.Run("should give up after the timeout", func(t *testing.T) {
+		api := &fakeCloudFront{pending: 1 << 30}
+		err := NewCDN(api, "E123").Wait(context.Background(), "I1", 20*time.Millisecond, fastPolling)
+		assert.ErrorIs(t, err, ErrInvalidation)
+	})
+}
+
+func TestInvalidationPaths(t *testing.T) {
+	keys := []string{"index.html", "posts/a.html", "posts/b.html", "posts/2026/index.html", "tags/go.html", "my post.html"}
+
+	tests := []struct {
+		name     string
+		maxPaths int
+		want     []string
+	}{
+		{
+			name:     "should list every changed path with directories for index pages",
+			maxPaths: 20,
+			want:     []string{"/", "/index.html", "/my%20post.html", "/posts/2026/", "/posts/2026/index.html", "/posts/a.html", "/posts/b.html", "/tags/go.html"},
+		},
+		{
+			name:     "should collapse the deepest directories first",
+			maxPaths: 7,
+			want:     []string{"/", "/index.html", "/my%20post.html", "/posts/2026/*", "/posts/a.html", "/posts/b.html", "/tags/go.html"},
+		},
+		{
+			name:     "should collapse to top level directories",
+			maxPaths: 5,
+			want:     []string{"/", "/index.html", "/my%20post.html", "/posts/*", "/tags/*"},
+		},
+		{
+			name:     "should fall back to everything",
+			maxPaths: 4,
+			want:     []string{"/*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, InvalidationPaths(keys, tt.maxPaths))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package aws
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+// NewS3Client loads the shared aws config for the connection settings and returns an s3 client.
+// A custom endpoint points the client at an S3 compatible store such as MinIO, R2 or Ceph.
+func NewS3Client(ctx context.Context, connection config.S3) (*s3.Client, error) {
+	cfg, err := loadConfig(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = connection.PathStyle
+		if connection.Endpoint != "" {
+			o.BaseEndpoint = aws.String(connection.Endpoint)
+			// not every S3 compatible store understands the checksums the sdk sends by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	}), nil
+}
+
+// NewCloudFrontClient returns a cloudfront client with the region and profile of the connection
+// settings. The s3 endpoint is not used, cloudfront is always reached at aws.
+func NewCloudFrontClient(ctx context.Context, connection config.S3) (*cloudfront.Client, error) {
+	cfg, err := loadConfig(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+	return cloudfront.NewFromConfig(cfg), nil
+}
+
+func loadConfig(ctx context.Context, connection config.S3) (aws.Config, error) {
+	loadOptions := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(connection.Region)}
+	if connection.Profile != "" {
+		loadOptions = append(loadOptions, awsconfig.WithSharedConfigProfile(connection.Profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		slog.Error("error loading aws config", "profile", connection.Profile, "error", err)
+		return aws.Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,66 @@
+package aws
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateAWSConfig points the sdk at a shared config file holding a single blog profile, so the
+// tests never read the aws config of the machine they run on.
+func isolateAWSConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(configFile, []byte("[profile blog]\nregion = eu-west-1\n"), 0666))
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+}
+
+func TestNewS3Client(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reach aws with the region and default checksums", func(t *testing.T) {
+		isolateAWSConfig(t)
+		client, err := NewS3Client(ctx, config.S3{Region: "us-east-2"})
+		require.NoError(t, err)
+
+		options := client.Options()
+		assert.Equal(t, "us-east-2", options.Region)
+		assert.Nil(t, options.BaseEndpoint)
+		assert.False(t, options.UsePathStyle)
+		assert.Equal(t, aws.RequestChecksumCalculationWhenSupported, options.RequestChecksumCalculation)
+	})
+
+	t.Run("should point at an S3 compatible endpoint", func(t *testing.T) {
+		isolateAWSConfig(t)
+		client, err := NewS3Client(ctx, config.S3{Region: "us-east-1", Endpoint: "http://127.0.0.1:9000", PathStyle: true})
+		require.NoError(t, err)
+
+		options := client.Options()
+		assert.Equal(t, "http://127.0.0.1:9000", aws.ToString(options.BaseEndpoint))
+		assert.True(t, options.UsePathStyle)
+		assert.Equal(t, aws.RequestChecksumCalculationWhenRequired, options.RequestChecksumCalculation)
+		assert.Equal(t, aws.ResponseChecksumValidationWhenRequired, options.ResponseChecksumValidation)
+	})
+
+	t.Run("should load the profile and fail for an unknown one", func(t *testing.T) {
+		isolateAWSConfig(t)
+		client, err := NewS3Client(ctx, config.S3{Profile: "blog"})
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", client.Options().Region)
+
+		_, err = NewS3Client(ctx, config.S3{Region: "us-east-2", Profile: "missing"})
+		assert.Error(t, err)
+	})
+}
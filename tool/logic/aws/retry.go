@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// retryables decides which errors are transient, using the same checks as the sdk's own retryer.
+var retryables = retry.IsErrorRetryables(retry.DefaultRetryables)
+
+type (
+	// RetryPolicy controls how often a failed request is attempted again. The delay before each
+	// retry is drawn at random up to BaseDelay doubled for every attempt, capped at MaxDelay.
+	RetryPolicy struct {
+		MaxAttempts int
+		BaseDelay   time.Duration
+		MaxDelay    time.Duration
+	}
+
+	// UploadError is a permanent failure to upload Key after Attempts tries.
+	UploadError struct {
+		Key      string
+		Attempts int
+		Err      error
+	}
+)
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("error writing file %s to s3 after %d attempts: %v", e.Key, e.Attempts, e.Err)
+}
+
+// Unwrap lets errors.Is match both the cause and ErrUploadFile.
+func (e *UploadError) Unwrap() []error {
+	return []error{e.Err, ErrUploadFile}
+}
+
+// do calls fn until it succeeds, fails with an error that is not transient, runs out of attempts
+// or ctx is done. It returns the number of attempts made along with the last error.
+func (p RetryPolicy) do(ctx context.Context, key string, fn func() error) (int, error) {
+	attempts := max(1, p.MaxAttempts)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return attempt, err
+		}
+
+		delay := p.backoff(attempt)
+		slog.Warn("transient error, retrying", "key", key, "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		ceiling = p.BaseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+func isTransient(err error) bool {
+	return retryables.IsErrorRetryable(err) == aws.TrueTernary
+}
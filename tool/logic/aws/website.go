@@ -0,0 +1,182 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var ErrNoWebsite = errors.New("bucket has no website configuration")
+
+const (
+	// releaseRedirectCode is a temporary redirect, so browsers do not cache the route to one release.
+	releaseRedirectCode = "302"
+	notFoundCode        = "404"
+)
+
+// Activate serves the site from the keys below release, a prefix relative to the site such as
+// releases/<id>/. It replaces the routing rules of the bucket website that belong to the site in
+// a single request, so every visitor switches to the new release at the same moment:
+//
+//	a request missing below the site prefix is redirected into the release
+//	a request missing inside a release is redirected to the error document of the release, or
+//	to the home page of the site when the release has none
+//
+// The second rule stops a page missing from the release from being redirected into itself
+// forever. Routing rules can only redirect, so a missing page ends on a page served with a 200
+// rather than a 404. Rules for other prefixes of the bucket are kept.
+func (c Client) Activate(ctx context.Context, release string) error {
+	website, err := c.website(ctx)
+	if err != nil {
+		return err
+	}
+	missing, err := c.missingPage(ctx, website, release)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]types.RoutingRule, 0, len(website.RoutingRules)+2)
+	for _, rule := range website.RoutingRules {
+		if !c.isReleaseRule(rule, release) {
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules,
+		types.RoutingRule{
+			Condition: c.notFoundBelow(c.prefix + releasesDir(release)),
+			Redirect: &types.Redirect{
+				HttpRedirectCode: aws.String(releaseRedirectCode),
+				ReplaceKeyWith:   aws.String(missing),
+			},
+		},
+		types.RoutingRule{
+			Condition: c.notFoundBelow(c.prefix),
+			Redirect: &types.Redirect{
+				HttpRedirectCode:     aws.String(releaseRedirectCode),
+				ReplaceKeyPrefixWith: aws.String(c.prefix + release),
+			},
+		},
+	)
+	// s3 applies the first matching rule, so the most specific prefix has to come first
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(conditionPrefix(rules[i])) > len(conditionPrefix(rules[j]))
+	})
+
+	_, err = c.client.PutBucketWebsite(ctx, &s3.PutBucketWebsiteInput{
+		Bucket: aws.String(c.bucket),
+		WebsiteConfiguration: &types.WebsiteConfiguration{
+			IndexDocument: website.IndexDocument,
+			ErrorDocument: website.ErrorDocument,
+			RoutingRules:  rules,
+		},
+	})
+	if err != nil {
+		slog.Error("error updating bucket website", "bucket", c.bucket, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Active returns the release prefix the bucket website routes the site to, or "" when it routes
+// to none.
+func (c Client) Active(ctx context.Context) (string, error) {
+	website, err := c.website(ctx)
+	if errors.Is(err, ErrNoWebsite) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range website.RoutingRules {
+		if conditionPrefix(rule) == c.prefix && c.isReleaseRule(rule, "") {
+			return strings.TrimPrefix(aws.ToString(rule.Redirect.ReplaceKeyPrefixWith), c.prefix), nil
+		}
+	}
+	return "", nil
+}
+
+// missingPage returns the key a request missing inside release is redirected to: the error
+// document of the website inside the release when the release holds it, the home page of the site
+// otherwise. Redirecting to a missing error document would redirect it to itself forever.
+func (c Client) missingPage(ctx context.Context, website *s3.GetBucketWebsiteOutput, release string) (string, error) {
+	home := c.prefix + indexDocument(website)
+	if website.ErrorDocument == nil {
+		return home, nil
+	}
+	errorDocument, ok := strings.CutPrefix(aws.ToString(website.ErrorDocument.Key), c.prefix)
+	if !ok || errorDocument == "" {
+		return home, nil
+	}
+
+	key := c.prefix + release + errorDocument
+	_, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(key)})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		slog.Warn("release has no error document, missing pages go to the home page", "key", key)
+		return home, nil
+	}
+	if err != nil {
+		slog.Error("error getting error document", "bucket", c.bucket, "key", key, "error", err)
+		return "", err
+	}
+	return key, nil
+}
+
+func (c Client) website(ctx context.Context) (*s3.GetBucketWebsiteOutput, error) {
+	website, err := c.client.GetBucketWebsite(ctx, &s3.GetBucketWebsiteInput{Bucket: aws.String(c.bucket)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchWebsiteConfiguration" {
+		return nil, fmt.Errorf("bucket %s: %w - %w", c.bucket, err, ErrNoWebsite)
+	}
+	if err != nil {
+		slog.Error("error getting bucket website", "bucket", c.bucket, "error", err)
+		return nil, err
+	}
+	return website, nil
+}
+
+// isReleaseRule reports whether rule is one of the two rules Activate writes for this site and
+// release.
+func (c Client) isReleaseRule(rule types.RoutingRule, release string) bool {
+	if rule.Condition == nil || aws.ToString(rule.Condition.HttpErrorCodeReturnedEquals) != notFoundCode || rule.Redirect == nil {
+		return false
+	}
+	prefix := conditionPrefix(rule)
+	return prefix == c.prefix || (release != "" && prefix == c.prefix+releasesDir(release))
+}
+
+func (c Client) notFoundBelow(prefix string) *types.Condition {
+	condition := &types.Condition{HttpErrorCodeReturnedEquals: aws.String(notFoundCode)}
+	if prefix != "" {
+		condition.KeyPrefixEquals = aws.String(prefix)
+	}
+	return condition
+}
+
+func conditionPrefix(rule types.RoutingRule) string {
+	if rule.Condition == nil {
+		return ""
+	}
+	return aws.ToString(rule.Condition.KeyPrefixEquals)
+}
+
+// releasesDir returns the directory holding release, releases/ for releases/<id>/.
+func releasesDir(release string) string {
+	dir, _, _ := strings.Cut(release, "/")
+	return dir + "/"
+}
+
+func indexDocument(website *s3.GetBucketWebsiteOutput) string {
+	if website.IndexDocument == nil || website.IndexDocument.Suffix == nil {
+		return "index.html"
+	}
+	return aws.ToString(website.IndexDocument.Suffix)
+}
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Activate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should route missing keys into the release and keep other sites", func(t *testing.T) {
+		docs := types.RoutingRule{
+			Condition: &types.Condition{KeyPrefixEquals: aws.String("docs/"), HttpErrorCodeReturnedEquals: aws.String("404")},
+			Redirect:  &types.Redirect{ReplaceKeyPrefixWith: aws.String("docs/v2/")},
+		}
+		api := &fakeS3{website: &types.WebsiteConfiguration{
+			IndexDocument: &types.IndexDocument{Suffix: aws.String("index.html")},
+			RoutingRules:  []types.RoutingRule{docs},
+		}}
+		client := New(api, "bucket", "", RetryPolicy{})
+
+		require.NoError(t, client.Activate(ctx, "releases/a/"))
+		require.NoError(t, client.Activate(ctx, "releases/b/"))
+
+		rules := api.website.RoutingRules
+		require.Len(t, rules, 3)
+		assert.Equal(t, "releases/", aws.ToString(rules[0].Condition.KeyPrefixEquals))
+		assert.Equal(t, "index.html", aws.ToString(rules[0].Redirect.ReplaceKeyWith))
+		assert.Equal(t, docs, rules[1])
+		assert.Nil(t, rules[2].Condition.KeyPrefixEquals)
+		assert.Equal(t, "releases/b/", aws.ToString(rules[2].Redirect.ReplaceKeyPrefixWith))
+		assert.Equal(t, "302", aws.ToString(rules[2].Redirect.HttpRedirectCode))
+		assert.Equal(t, "index.html", aws.ToString(api.website.IndexDocument.Suffix))
+
+		active, err := client.Active(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "releases/b/", active)
+	})
+
+	t.Run("should scope the rules to the prefix of the site", func(t *testing.T) {
+		api := &fakeS3{website: &types.WebsiteConfiguration{}}
+		client := New(api, "bucket", "blog", RetryPolicy{})
+
+		require.NoError(t, client.Activate(ctx, "releases/a/"))
+		rules := api.website.RoutingRules
+		require.Len(t, rules, 2)
+		assert.Equal(t, "blog/releases/", aws.ToString(rules[0].Condition.KeyPrefixEquals))
+		assert.Equal(t, "blog/index.html", aws.ToString(rules[0].Redirect.ReplaceKeyWith))
+		assert.Equal(t, "blog/", aws.ToString(rules[1].Condition.KeyPrefixEquals))
+		assert.Equal(t, "blog/releases/a/", aws.ToString(rules[1].Redirect.ReplaceKeyPrefixWith))
+
+		active, err := client.Active(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "releases/a/", active)
+	})
+
+	t.Run("should send missing pages to the error document of the release when it has one", func(t *testing.T) {
+		api := &fakeS3{website: &types.WebsiteConfiguration{
+			IndexDocument: &types.IndexDocument{Suffix: aws.String("index.html")},
+			ErrorDocument: &types.ErrorDocument{Key: aws.String("blog/404.html")},
+		}}
+		api.add("blog/releases/b/404.html", fakeObject{})
+		client := New(api, "bucket", "blog", RetryPolicy{})
+
+		require.NoError(t, client.Activate(ctx, "releases/a/"))
+		assert.Equal(t, "blog/index.html", aws.ToString(api.website.RoutingRules[0].Redirect.ReplaceKeyWith))
+
+		require.NoError(t, client.Activate(ctx, "releases/b/"))
+		assert.Equal(t, "blog/releases/b/404.html", aws.ToString(api.website.RoutingRules[0].Redirect.ReplaceKeyWith))
+		assert.Equal(t, "blog/404.html", aws.ToString(api.website.ErrorDocument.Key))
+	})
+
+	t.Run("should need website hosting", func(t *testing.T) {
+		client := New(&fakeS3{}, "bucket", "", RetryPolicy{})
+		assert.ErrorIs(t, client.Activate(ctx, "releases/a/"), ErrNoWebsite)
+
+		active, err := client.Active(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, active)
+	})
+}
@@ -0,0 +1,163 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ManifestName is the file in the build output listing every file of the artifact. It starts
+// with a dot so it is never mistaken for part of the site.
+const (
+	ManifestName    = ".manifest.json"
+	manifestVersion = 1
+)
+
+var ErrInvalidArtifact = errors.New("invalid build artifact")
+
+type (
+	// Manifest describes a built site so it can be deployed later exactly as it was built.
+	Manifest struct {
+		Version int            `json:"version"`
+		Files   []ManifestFile `json:"files"`
+	}
+
+	ManifestFile struct {
+		Key              string `json:"key"`
+		MD5              string `json:"md5"`
+		ContentType      string `json:"content_type"`
+		ContentEncoding  string `json:"content_encoding,omitempty"`
+		RedirectLocation string `json:"redirect_location,omitempty"`
+		Size             int64  `json:"size"`
+	}
+)
+
+// WriteArtifact writes outputFiles below dir along with a manifest of their keys, hashes, content
+// types and encodings. Files the manifest of an earlier build in dir lists that are not part of
+// this build are removed, so dir holds what ships. Other files in dir are left alone.
+func WriteArtifact(dir string, outputFiles []OutputFile) error {
+	previous := readManifest(dir)
+	manifest := Manifest{
+		Version: manifestVersion,
+		Files:   make([]ManifestFile, 0, len(outputFiles)),
+	}
+	for _, outputFile := range outputFiles {
+		err := writeOutputFile(dir, outputFile)
+		if err != nil {
+			slog.Error("error writing file to build output", "key", outputFile.Key, "error", err)
+			return err
+		}
+
+		hash, err := calcMD5(bytes.NewReader(outputFile.Body))
+		if err != nil {
+			slog.Error("error calculating hash", "key", outputFile.Key, "error", err)
+			return err
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Key:              outputFile.Key,
+			MD5:              hash,
+			ContentType:      outputFile.ContentType,
+			ContentEncoding:  outputFile.ContentEncoding,
+			RedirectLocation: outputFile.RedirectLocation,
+			Size:             int64(len(outputFile.Body)),
+		})
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestName), append(b, '\n'), 0666); err != nil {
+		return err
+	}
+	return removeStaleFiles(dir, previous, manifest)
+}
+
+// readManifest returns the manifest of the build in dir, or an empty one when there is none.
+func readManifest(dir string) Manifest {
+	var manifest Manifest
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		slog.Warn("ignoring unreadable manifest of the previous build", "dir", dir, "error", err)
+		return Manifest{}
+	}
+	return manifest
+}
+
+// removeStaleFiles deletes the files of previous that are not in current, along with the
+// directories they leave empty.
+func removeStaleFiles(dir string, previous, current Manifest) error {
+	keep := make(map[string]bool, len(current.Files))
+	for _, file := range current.Files {
+		keep[file.Key] = true
+	}
+	root := filepath.Clean(dir)
+	for _, file := range previous.Files {
+		if keep[file.Key] || !filepath.IsLocal(filepath.FromSlash(file.Key)) {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(file.Key))
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("error removing file of the previous build", "key", file.Key, "error", err)
+			return err
+		}
+		for parent := filepath.Dir(path); parent != root; parent = filepath.Dir(parent) {
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// LoadArtifact reads the files listed in the manifest of a build output. Files in dir that are
+// not in the manifest, such as files put there by hand, are ignored. A file whose content no
+// longer matches its hash fails the load, so what ships is exactly what was built.
+func LoadArtifact(dir string) ([]OutputFile, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest in %s: %w - %w", dir, err, ErrInvalidArtifact)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("error decoding manifest in %s: %w - %w", dir, err, ErrInvalidArtifact)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("manifest in %s has version %d, expected %d: %w", dir, manifest.Version, manifestVersion, ErrInvalidArtifact)
+	}
+
+	outputFiles := make([]OutputFile, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Key)) {
+			return nil, fmt.Errorf("manifest key %s is outside %s: %w", file.Key, dir, ErrInvalidArtifact)
+		}
+		body, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Key)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w - %w", file.Key, err, ErrInvalidArtifact)
+		}
+		hash, err := calcMD5(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if hash != file.MD5 {
+			return nil, fmt.Errorf("%s changed since it was built: %w", file.Key, ErrInvalidArtifact)
+		}
+
+		outputFiles = append(outputFiles, OutputFile{
+			Key:              file.Key,
+			ContentType:      file.ContentType,
+			ContentEncoding:  file.ContentEncoding,
+			RedirectLocation: file.RedirectLocation,
+			Body:             body,
+		})
+	}
+	return outputFiles, nil
+}
@@ -0,0 +1,54 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadArtifact(t *testing.T) {
+	files := []OutputFile{
+		{Key: IndexKey, ContentType: contentTypeHTML, Body: []byte("<h1>home</h1>")},
+		{Key: "css/theme.css", ContentType: contentTypeCSS, ContentEncoding: EncodingGzip, Body: []byte("gzipped")},
+		{Key: "old.html", ContentType: contentTypeHTML, RedirectLocation: "posts/new.html", Body: []byte("moved")},
+	}
+
+	t.Run("should load only the files in the manifest", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, WriteArtifact(dir, files))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "leftover.html"), []byte("old"), 0666))
+
+		loaded, err := LoadArtifact(dir)
+		require.NoError(t, err)
+		assert.Equal(t, files, loaded)
+	})
+
+	t.Run("should remove the files of the previous build that are gone", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, WriteArtifact(dir, append(files, OutputFile{Key: "posts/other.html", ContentType: contentTypeHTML, Body: []byte("other")})))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine"), 0666))
+
+		require.NoError(t, WriteArtifact(dir, files))
+		assert.NoFileExists(t, filepath.Join(dir, "posts", "other.html"))
+		assert.NoDirExists(t, filepath.Join(dir, "posts"))
+		assert.FileExists(t, filepath.Join(dir, "notes.txt"), "files no build wrote are kept")
+		assert.FileExists(t, filepath.Join(dir, "css", "theme.css"))
+	})
+
+	t.Run("should fail when a file changed after the build", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, WriteArtifact(dir, files))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, IndexKey), []byte("edited"), 0666))
+
+		_, err := LoadArtifact(dir)
+		assert.ErrorIs(t, err, ErrInvalidArtifact)
+	})
+
+	t.Run("should fail without a manifest", func(t *testing.T) {
+		_, err := LoadArtifact(t.TempDir())
+		assert.ErrorIs(t, err, ErrInvalidArtifact)
+	})
+}
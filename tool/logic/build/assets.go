@@ -0,0 +1,146 @@
+package build
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// extraContentTypes covers web file types missing from the mime tables of some systems.
+var extraContentTypes = map[string]string{
+	".avif":        "image/avif",
+	".ico":         "image/x-icon",
+	".otf":         "font/otf",
+	".ttf":         "font/ttf",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+}
+
+var _ AssetHandler = HandleAsset{}
+
+type (
+	AssetHandler interface {
+		GetStaticFiles(ctx context.Context) ([]OutputFile, error)
+		GetPageAssets(ctx context.Context, markdownDirectory string) ([]OutputFile, error)
+	}
+
+	HandleAsset struct {
+		staticDirectory string
+	}
+)
+
+func NewHandleAsset(staticDirectory string) *HandleAsset {
+	return &HandleAsset{
+		staticDirectory: staticDirectory,
+	}
+}
+
+// GetStaticFiles returns every file in the static directory, keyed relative to it. A missing directory is empty.
+func (a HandleAsset) GetStaticFiles(ctx context.Context) ([]OutputFile, error) {
+	if _, err := os.Stat(a.staticDirectory); os.IsNotExist(err) {
+		return []OutputFile{}, nil
+	}
+	return readAssets(a.staticDirectory, func(string) bool { return true })
+}
+
+// GetPageAssets returns the files that sit next to the markdown, such as images referenced from posts.
+func (a HandleAsset) GetPageAssets(ctx context.Context, markdownDirectory string) ([]OutputFile, error) {
+	return readAssets(markdownDirectory, func(p string) bool {
+		return !strings.EqualFold(filepath.Ext(p), markdownFileExtension)
+	})
+}
+
+// readAssets reads every file below rootPath accepted by include, skipping hidden files and directories.
+func readAssets(rootPath string, include func(path string) bool) ([]OutputFile, error) {
+	assets := make([]OutputFile, 0)
+	err := filepath.WalkDir(rootPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != rootPath && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !include(p) {
+			return nil
+		}
+
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootPath, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		assets = append(assets, OutputFile{
+			Key:         key,
+			ContentType: DetectContentType(key, body),
+			Body:        body,
+			Modified:    info.ModTime().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		slog.Error("error reading assets", "path", rootPath, "error", err)
+		return nil, err
+	}
+	return assets, nil
+}
+
+// DetectContentType picks a content type from the file extension, falling back to sniffing the content.
+func DetectContentType(key string, body []byte) string {
+	ext := strings.ToLower(path.Ext(key))
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	if contentType, ok := extraContentTypes[ext]; ok {
+		return contentType
+	}
+	return http.DetectContentType(body)
+}
+
+// mergeStaticFiles adds the static files to the generated ones. A static file replaces a generated
+// file with the same key so that, for example, a hand written robots.txt wins. Among the static
+// files the later one wins.
+func mergeStaticFiles(generated, static []OutputFile) []OutputFile {
+	staticIndex := make(map[string]int, len(static))
+	deduped := make([]OutputFile, 0, len(static))
+	for _, file := range static {
+		if i, ok := staticIndex[file.Key]; ok {
+			slog.Info("static file replaces static file", "key", file.Key)
+			deduped[i] = file
+			continue
+		}
+		staticIndex[file.Key] = len(deduped)
+		deduped = append(deduped, file)
+	}
+
+	merged := make([]OutputFile, 0, len(generated)+len(deduped))
+	for _, file := range generated {
+		if _, ok := staticIndex[file.Key]; ok {
+			slog.Info("static file replaces generated file", "key", file.Key)
+			continue
+		}
+		merged = append(merged, file)
+	}
+	return append(merged, deduped...)
+}
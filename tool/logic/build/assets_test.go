@@ -0,0 +1,70 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		key  string
+		body []byte
+		want string
+	}{
+		{key: "img/photo.PNG", want: "image/png"},
+		{key: "fonts/inter.woff2", want: "font/woff2"},
+		{key: "js/app.js", want: "text/javascript; charset=utf-8"},
+		{key: "no-extension", body: []byte("\x89PNG\r\n\x1a\n"), want: "image/png"},
+		{key: "unknown.lol", body: []byte("plain words"), want: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectContentType(tt.key, tt.body))
+		})
+	}
+}
+
+func TestHandleAsset_GetPageAssets(t *testing.T) {
+	t.Run("should return files next to markdown except markdown and hidden files", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "posts", ".drafts"), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", "post.md"), []byte("# post"), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", "diagram.svg"), []byte("<svg></svg>"), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", ".drafts", "secret.png"), []byte("x"), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*"), 0666))
+
+		assets, err := NewHandleAsset("").GetPageAssets(context.Background(), dir)
+		require.NoError(t, err)
+		require.Len(t, assets, 1)
+		assert.Equal(t, "posts/diagram.svg", assets[0].Key)
+		assert.Equal(t, "image/svg+xml", assets[0].ContentType)
+		assert.Equal(t, "<svg></svg>", string(assets[0].Body))
+	})
+}
+
+func TestHandleAsset_GetStaticFiles(t *testing.T) {
+	t.Run("should return nothing for a missing directory", func(t *testing.T) {
+		files, err := NewHandleAsset(filepath.Join(t.TempDir(), "missing")).GetStaticFiles(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+}
+
+func TestMergeStaticFiles(t *testing.T) {
+	t.Run("should let static files replace generated files", func(t *testing.T) {
+		generated := []OutputFile{{Key: IndexKey, Body: []byte("generated")}, {Key: RobotsKey, Body: []byte("generated")}}
+		static := []OutputFile{{Key: RobotsKey, Body: []byte("page asset")}, {Key: "img/a.png"}, {Key: RobotsKey, Body: []byte("static")}}
+
+		merged := mergeStaticFiles(generated, static)
+		require.Len(t, merged, 3)
+		assert.Equal(t, IndexKey, merged[0].Key)
+		assert.Equal(t, RobotsKey, merged[1].Key)
+		assert.Equal(t, "static", string(merged[1].Body))
+		assert.Equal(t, "img/a.png", merged[2].Key)
+	})
+}
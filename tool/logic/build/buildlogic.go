@@ -1,7 +1,6 @@
 package build
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
@@ -13,8 +12,11 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+)
 
-	"github.com/rmarken5/blog-builder/tool/logic/aws"
+const (
+	contentTypeHTML = "text/html"
+	contentTypeCSS  = "text/css"
 )
 
 type (
@@ -25,337 +27,203 @@ type (
 		htmlHandler     HTMLHandler
 		cssHandler      CSSHandler
 		markdownHandler MarkdownHandler
-		s3Client        aws.S3Client
+		layoutHandler   LayoutHandler
+		themeHandler    ThemeHandler
+		feedHandler     FeedHandler
+		sitemapHandler  SitemapHandler
+		assetHandler    AssetHandler
+		redirectHandler RedirectHandler
+		compression     string
+	}
+
+	// OutputFile is a single rendered file of the site, keyed relative to the site root.
+	// Modified is when its content last changed, left zero when unknown. ContentEncoding is the
+	// compression applied to Body, empty when it is not compressed. RedirectLocation is set for an
+	// old path of the site and is where a request for it is redirected to; Body is then the page
+	// served by targets that cannot redirect.
+	OutputFile struct {
+		Key              string
+		ContentType      string
+		ContentEncoding  string
+		RedirectLocation string
+		Body             []byte
+		Modified         time.Time
 	}
 )
 
-func NewPayloadBuilder(htmlHandler HTMLHandler, cssHandler CSSHandler, markdownHandler MarkdownHandler, s3Client aws.S3Client) *BuildPayload {
+func NewPayloadBuilder(htmlHandler HTMLHandler, cssHandler CSSHandler, markdownHandler MarkdownHandler, layoutHandler LayoutHandler, themeHandler ThemeHandler, feedHandler FeedHandler, sitemapHandler SitemapHandler, assetHandler AssetHandler, redirectHandler RedirectHandler, compression string) *BuildPayload {
 	return &BuildPayload{
 		htmlHandler:     htmlHandler,
 		cssHandler:      cssHandler,
 		markdownHandler: markdownHandler,
-		s3Client:        s3Client,
+		layoutHandler:   layoutHandler,
+		themeHandler:    themeHandler,
+		feedHandler:     feedHandler,
+		sitemapHandler:  sitemapHandler,
+		assetHandler:    assetHandler,
+		redirectHandler: redirectHandler,
+		compression:     compression,
 	}
 }
 
-func (b BuildPayload) BuildToS3(ctx context.Context, inputPath, payloadPath string) error {
-	uploadedFiles := make([]string, 0)
-	rHashes, err := b.s3Client.GetBucketHashes(ctx)
+// BuildPayload writes the site and its manifest to payloadPath, ready to be published with
+// LoadArtifact and Publisher.Deploy.
+func (b BuildPayload) BuildPayload(ctx context.Context, inputPath, payloadPath string) error {
+	outputFiles, err := b.RenderSite(ctx, inputPath, payloadPath)
 	if err != nil {
-		slog.Error("error calculating hash from s3", "error", err)
-
+		return err
 	}
-	slog.Info("remote hashes", "hashes", rHashes)
 
-	localHashes := make(map[string]string, 0)
-	log.Println("creating build directory")
+	log.Printf("building to %s", payloadPath)
+	return WriteArtifact(payloadPath, outputFiles)
+}
+
+// RenderSite builds every file of the site in memory, compressed when the builder has a
+// compression. The local build and every deploy start from its output so they always receive the
+// same bytes.
+func (b BuildPayload) RenderSite(ctx context.Context, inputPath, payloadPath string) ([]OutputFile, error) {
+	outputFiles := make([]OutputFile, 0)
+
+	themeCSSFiles, err := b.themeHandler.GetThemeCSSFiles(ctx)
+	if err != nil {
+		slog.Error("error getting css files from theme", "error", err)
+		return nil, err
+	}
 
 	cssFiles, err := b.cssHandler.GetCSSFilesFromSource(ctx)
 	if err != nil {
 		slog.Error("error getting css files from css directory", "error", err)
-		return err
+		return nil, err
 	}
 
+	// theme stylesheets are linked first so the user's css can override them
+	for i := range cssFiles {
+		cssFiles[i].Path = strings.TrimPrefix(filepath.ToSlash(b.cssHandler.BuildPathFromSource(cssFiles[i].Path)), filepath.ToSlash(payloadPath)+"/")
+	}
+	cssFiles = mergeCSSFiles(themeCSSFiles, cssFiles)
+
+	stylesheets := make([]string, 0, len(cssFiles))
 	for _, cssFile := range cssFiles {
-		lKey := strings.TrimPrefix(cssFile.Path, payloadPath+"/")
 		minifiedBytes, err := b.cssHandler.MinifyCSS(ctx, cssFile.Reader)
+		cssFile.Reader.Close()
 		if err != nil {
-			slog.Error("error minifying css file", "error", err)
-			return err
+			slog.Error("error minifying css file", "path", cssFile.Path, "error", err)
+			return nil, err
 		}
 
-		hash, err := calcMD5(bytes.NewReader(minifiedBytes))
-		if err != nil {
-			slog.Error("error calculating hash", "error", err)
-		}
-
-		localHashes[lKey] = hash
-		if shouldUpload(rHashes, lKey, hash) {
-			slog.Info("No matching hash, writing file to s3", "file", lKey)
-			uploadedFiles = append(uploadedFiles, lKey)
-			err = b.s3Client.WriteFileToBucket(ctx, lKey, "text/css", bytes.NewReader(minifiedBytes))
-			if err != nil {
-				slog.Error("error writing to s3", "key", lKey, "error", err)
-			}
-		}
+		stylesheets = append(stylesheets, cssFile.Path)
+		outputFiles = append(outputFiles, OutputFile{
+			Key:         cssFile.Path,
+			ContentType: contentTypeCSS,
+			Body:        minifiedBytes,
+		})
 	}
 
 	log.Printf("reading markdown from %s", inputPath)
 	markdownFiles, err := b.markdownHandler.GetMarkdownFilesFromPath(ctx, inputPath)
 	if err != nil {
 		slog.Error("error reading markdown directory", "error", err)
-		return err
+		return nil, err
 	}
+	pages := make([]Page, 0, len(markdownFiles))
 	for _, mdFile := range markdownFiles {
-		mdBytes := bytes.NewBuffer([]byte{})
-		_, err := io.Copy(mdBytes, mdFile.Reader)
+		page, err := b.loadPage(ctx, mdFile, inputPath)
 		if err != nil {
-			slog.Error("error copying bytes to buffer for mdfile", "error", err)
+			return nil, err
 		}
-		mdFile.Reader.Close()
+		pages = append(pages, page)
+	}
 
-		tags, err := GetTags(ctx, bytes.NewReader(mdBytes.Bytes()), findTags)
-		if err != nil {
-			slog.Error("error getting tags from markdown file", "error", err)
-			return err
-		}
-		createdAtDate, err := GetCreatedAtDate(ctx, bytes.NewReader(mdBytes.Bytes()), findCreatedAt)
+	for _, page := range pages {
+		htmlBytes, err := b.renderPage(ctx, page.Layout, page.Key, PageData{
+			Page:    page,
+			Content: page.Content,
+		}, stylesheets)
 		if err != nil {
-			slog.Error("error getting createdAt date from md", "error", err)
-		}
-		mdStripped, err := RemoveMetaData(ctx, bytes.NewReader(mdBytes.Bytes()))
-		if err != nil {
-			slog.Error("error removing metadata from md", "error", err)
-		}
-		htmlBytes, err := b.htmlHandler.ConvertMDToHTML(ctx, bytes.NewReader(mdStripped))
-		if err != nil {
-			slog.Error("error converting md to html", "error", err)
-			return err
-		}
-		htmlBytes, err = InjectMetadataHeader(ctx, bytes.NewReader(htmlBytes), Metadata{
-			Tags:      tags,
-			CreatedAt: createdAtDate.Format(time.RFC850),
-		})
-		if err != nil {
-			slog.Error("error injecting metadata into html", "error", err)
-		}
-		for _, cssFile := range cssFiles {
-			cssPath := strings.TrimPrefix(cssFile.Path, payloadPath+"/")
-			count := strings.Count(mdFile.Path, "/")
-			cssPath = strings.Repeat("../", count-1) + cssPath
-
-			htmlBytes, err = b.cssHandler.InjectCSSIntoHTML(ctx, bytes.NewReader(htmlBytes), cssPath)
-			if err != nil {
-				slog.Error("error injecting css into html", "error", err)
-				return err
-			}
+			return nil, err
 		}
 
-		htmlBytes, err = b.htmlHandler.ConvertMdLinksToHtml(bytes.NewReader(htmlBytes))
-		if err != nil {
-			slog.Error("error converting md to html", "error", err)
-			return err
-		}
+		outputFiles = append(outputFiles, OutputFile{
+			Key:         page.Key,
+			ContentType: contentTypeHTML,
+			Body:        htmlBytes,
+			Modified:    page.LastMod(),
+		})
+	}
 
-		hash, err := calcMD5(bytes.NewReader(htmlBytes))
+	if hasPage(pages, IndexKey) {
+		slog.Info("markdown index found, not generating home page", "key", IndexKey)
+	} else {
+		home, err := b.renderHome(ctx, pages, stylesheets)
 		if err != nil {
-			slog.Error("error calculating hash for html", "path", mdFile.Path, "error", err)
-			return err
-		}
-
-		lKey := strings.Replace(strings.TrimPrefix(mdFile.Path, inputPath+"/"), markdownFileExtension, HTMLFileExtension, -1)
-		if shouldUpload(rHashes, lKey, hash) {
-			slog.Info("No matching hash, writing file to s3", "file", lKey)
-			uploadedFiles = append(uploadedFiles, lKey)
-			err = b.s3Client.WriteFileToBucket(ctx, lKey, "text/html", bytes.NewReader(htmlBytes))
-			if err != nil {
-				slog.Error("error writing to s3", "key", lKey, "error", err)
-			}
+			return nil, err
 		}
-		localHashes[lKey] = hash
+		outputFiles = append(outputFiles, home)
 	}
 
-	log.Printf("files written to s3: %v", uploadedFiles)
-
-	return nil
-}
-
-func (b BuildPayload) BuildPayload(ctx context.Context, inputPath, payloadPath string) error {
-	rHashes, err := b.s3Client.GetBucketHashes(ctx)
+	tagFiles, err := b.renderTags(ctx, pages, stylesheets)
 	if err != nil {
-		slog.Error("error calculating hash from s3", "error", err)
-
+		return nil, err
 	}
-	slog.Info("remote hashes", "hashes", rHashes)
+	outputFiles = append(outputFiles, tagFiles...)
 
-	localHashes := make(map[string]string)
-	log.Println("creating build directory")
-
-	buildPaths, err := b.markdownHandler.GetMarkdownDirectoryStructure(ctx, inputPath)
+	feedFiles, err := b.feedHandler.BuildFeeds(ctx, pages)
 	if err != nil {
-		slog.Error("error getting build paths from markdown directory", "error", err)
-		return err
-	}
-
-	for _, p := range buildPaths {
-		_, err := b.htmlHandler.CreateBuildDirectoryForPath(ctx, p)
-		if err != nil {
-			if !os.IsExist(err) {
-				slog.Error("error making directory for build path", "error", err)
-				return err
-			}
-		}
+		return nil, err
 	}
+	outputFiles = append(outputFiles, feedFiles...)
 
-	cssBuildPaths, err := b.cssHandler.GetCSSDirectoryStructure(ctx)
+	pageAssets, err := b.assetHandler.GetPageAssets(ctx, inputPath)
 	if err != nil {
-		slog.Error("error getting build paths from css directory", "error", err)
-		return err
-	}
-
-	for _, p := range cssBuildPaths {
-		_, err := b.cssHandler.CreateBuildDirectoryForPath(ctx, p)
-		if err != nil {
-			if !os.IsExist(err) {
-				slog.Error("error making directory for css build path", "error", err)
-				return err
-			}
-		}
+		slog.Error("error getting assets from markdown directory", "error", err)
+		return nil, err
 	}
-
-	cssFiles, err := b.cssHandler.GetCSSFilesFromSource(ctx)
+	staticFiles, err := b.assetHandler.GetStaticFiles(ctx)
 	if err != nil {
-		slog.Error("error getting css files from css directory", "error", err)
-		return err
-	}
-
-	for _, cssFile := range cssFiles {
-		minifiedBytes, err := b.cssHandler.MinifyCSS(ctx, cssFile.Reader)
-		if err != nil {
-			slog.Error("error minifying css file", "error", err)
-			return err
-		}
-
-		cssBuildFile, err := b.cssHandler.CreateBuildFileFromCSSSource(ctx, cssFile.Path)
-		if err != nil {
-			slog.Error("error creating css file", "error", err)
-			return err
-		}
-		_, err = cssBuildFile.Write(minifiedBytes)
-		if err != nil {
-			slog.Error("error writing minified bytes to build output", "error", err)
-			return err
-		}
-		cssBuildFile.Close()
-
-		hash, err := calcMD5(bytes.NewReader(minifiedBytes))
-		if err != nil {
-			slog.Error("error calculating hash", "error", err)
-		}
-
-		lKey := strings.TrimPrefix(cssFile.Path, payloadPath+"/")
-		if shouldUpload(rHashes, lKey, hash) {
-			slog.Info("No matching hash, writing file to s3", "file", lKey)
-			err = b.s3Client.WriteFileToBucket(ctx, lKey, "text/css", bytes.NewReader(minifiedBytes))
-			if err != nil {
-				slog.Error("error writing to s3", "key", lKey, "error", err)
-			}
-		}
-		localHashes[lKey] = hash
+		slog.Error("error getting files from static directory", "error", err)
+		return nil, err
 	}
+	outputFiles = mergeStaticFiles(outputFiles, append(pageAssets, staticFiles...))
 
-	cssBuildFiles, err := b.cssHandler.GetBuiltCSSFiles(ctx)
+	// the sitemap lists static html pages too, while a static sitemap.xml or robots.txt still
+	// replaces the generated one
+	sitemapFiles, err := b.sitemapHandler.BuildSitemap(ctx, outputFiles)
 	if err != nil {
-		slog.Error("error getting built css files", "error", err)
-		return err
+		return nil, err
 	}
-
-	log.Printf("reading markdown from %s and building to %s", inputPath, payloadPath)
-	markdownFiles, err := b.markdownHandler.GetMarkdownFilesFromPath(ctx, inputPath)
+	robots, err := b.sitemapHandler.BuildRobots(ctx)
 	if err != nil {
-		slog.Error("error reading markdown directory", "error", err)
-		return err
+		return nil, err
 	}
-	for _, mdFile := range markdownFiles {
-		mdBytes := bytes.NewBuffer([]byte{})
-		_, err := io.Copy(mdBytes, mdFile.Reader)
-		if err != nil {
-			slog.Error("error copying bytes to buffer for mdfile", "error", err)
-		}
-		mdFile.Reader.Close()
+	outputFiles = mergeStaticFiles(append(sitemapFiles, robots), outputFiles)
 
-		tags, err := GetTags(ctx, bytes.NewReader(mdBytes.Bytes()), findTags)
-		if err != nil {
-			slog.Error("error getting tags from markdown file", "error", err)
-			return err
-		}
-		createdAtDate, err := GetCreatedAtDate(ctx, bytes.NewReader(mdBytes.Bytes()), findCreatedAt)
-		if err != nil {
-			slog.Error("error getting createdAt date from md", "error", err)
-		}
-		mdStripped, err := RemoveMetaData(ctx, bytes.NewReader(mdBytes.Bytes()))
-		if err != nil {
-			slog.Error("error removing metadata from md", "error", err)
-		}
-		htmlBytes, err := b.htmlHandler.ConvertMDToHTML(ctx, bytes.NewReader(mdStripped))
-		if err != nil {
-			slog.Error("error converting md to html", "error", err)
-			return err
-		}
-		htmlBytes, err = InjectMetadataHeader(ctx, bytes.NewReader(htmlBytes), Metadata{
-			Tags:      tags,
-			CreatedAt: createdAtDate.Format(time.RFC850),
-		})
-		if err != nil {
-			slog.Error("error injecting metadata into html", "error", err)
-		}
-
-		for _, css := range cssBuildFiles {
-			cssPath := strings.TrimPrefix(css.Path, payloadPath+"/")
-			p := strings.Replace(mdFile.Path, inputPath, payloadPath, -1)
-			log.Println("path, ", p)
-			count := strings.Count(p, "/")
-			cssPath = strings.Repeat("../", count-1) + cssPath
-
-			htmlBytes, err = b.cssHandler.InjectCSSIntoHTML(ctx, bytes.NewReader(htmlBytes), cssPath)
-			if err != nil {
-				slog.Error("error injecting css into html", "error", err)
-				return err
-			}
-		}
-
-		htmlBytes, err = b.htmlHandler.ConvertMdLinksToHtml(bytes.NewReader(htmlBytes))
-		if err != nil {
-			slog.Error("error converting md to html", "error", err)
-			return err
-		}
-
-		htmlFile, err := b.htmlHandler.CreateFileFromMDPath(ctx, mdFile.Path)
-		if err != nil {
-			slog.Error("error creating html file from markdown", "error", err)
-			return err
-		}
-
-		err = b.htmlHandler.WriteHTML(ctx, htmlFile, htmlBytes)
-		if err != nil {
-			slog.Error("error writing to html to file")
-		}
-		htmlFile.Close()
-
-		hash, err := calcMD5(bytes.NewReader(htmlBytes))
-		if err != nil {
-			slog.Error("error calculating hash for html", "path", mdFile.Path, "error", err)
-			return err
-		}
-		lKey := strings.Replace(strings.TrimPrefix(mdFile.Path, inputPath+"/"), markdownFileExtension, HTMLFileExtension, -1)
-		if shouldUpload(rHashes, lKey, hash) {
-			slog.Info("No matching hash, writing file to s3", "file", lKey)
-			err = b.s3Client.WriteFileToBucket(ctx, lKey, "text/html", bytes.NewReader(htmlBytes))
-			if err != nil {
-				slog.Error("error writing to s3", "key", lKey, "error", err)
-			}
-		}
-		localHashes[lKey] = hash
+	redirectFiles, err := b.redirectHandler.BuildRedirects(ctx, pages, outputFiles)
+	if err != nil {
+		slog.Error("error building redirects", "error", err)
+		return nil, err
 	}
+	outputFiles = append(outputFiles, redirectFiles...)
 
-	for _, css := range cssBuildFiles {
-		css.Reader.Close()
+	compressed, err := compressFiles(outputFiles, b.compression)
+	if err != nil {
+		slog.Error("error compressing site", "error", err)
+		return nil, err
 	}
-
-	slog.Info("local hashes", "hashes", localHashes)
-
-	return nil
+	return compressed, nil
 }
 
 func getFilesFromDirectory(rootPath, extension string) ([]ReaderWithPath, error) {
 	files := make([]ReaderWithPath, 0)
 	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
 		if d.IsDir() {
 			return nil
 		}
 
-		if strings.ToLower(path[len(path)-len(extension):]) != strings.ToLower(extension) {
+		if !strings.HasSuffix(strings.ToLower(path), strings.ToLower(extension)) {
 			return nil
 		}
 
@@ -380,6 +248,9 @@ func getFilesFromDirectory(rootPath, extension string) ([]ReaderWithPath, error)
 func getDirectoryStructure(rootPath string) ([]string, error) {
 	dirs := make([]string, 0)
 	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
 		if d.IsDir() {
 			dirs = append(dirs, path)
@@ -394,6 +265,16 @@ func getDirectoryStructure(rootPath string) ([]string, error) {
 	return dirs, nil
 }
 
+// writeOutputFile writes outputFile below payloadPath, creating its directory when needed.
+func writeOutputFile(payloadPath string, outputFile OutputFile) error {
+	filePath := filepath.Join(payloadPath, filepath.FromSlash(outputFile.Key))
+	err := os.MkdirAll(filepath.Dir(filePath), 0777)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, outputFile.Body, 0666)
+}
+
 func calcMD5(r io.Reader) (string, error) {
 	hash := md5.New()
 	if _, err := io.Copy(hash, r); err != nil {
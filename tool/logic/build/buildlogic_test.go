@@ -0,0 +1,177 @@
+package build
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTarget keeps the published files in memory and records what the build did to it.
+type fakeTarget struct {
+	mu      sync.Mutex
+	hashes  map[string]string
+	hashErr error
+	fail    map[string]error
+	written []string
+	deleted []string
+}
+
+func (f *fakeTarget) GetHashes(ctx context.Context) (map[string]string, error) {
+	return f.hashes, f.hashErr
+}
+
+func (f *fakeTarget) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (f *fakeTarget) WriteFile(ctx context.Context, key string, file io.Reader, opts target.ObjectOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err, ok := f.fail[key]; ok {
+		return err
+	}
+	f.written = append(f.written, key)
+	return nil
+}
+
+func (f *fakeTarget) DeleteFiles(ctx context.Context, keys []string) error {
+	f.deleted = append(f.deleted, keys...)
+	return nil
+}
+
+// newTestBuilder returns a builder over a markdown directory holding a single post.
+func newTestBuilder(t *testing.T) (*BuildPayload, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	markdownDir := filepath.Join(dir, "markdown")
+	outputDir := filepath.Join(dir, "build")
+	require.NoError(t, os.MkdirAll(markdownDir, 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "css"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(markdownDir, "post.md"), []byte("# Post\n\nHello"), 0666))
+
+	themeHandler, err := NewHandleTheme("", "")
+	require.NoError(t, err)
+	cfg := config.Default()
+	layoutHandler, err := NewHandleLayout(themeHandler.Layouts(), cfg.Site)
+	require.NoError(t, err)
+
+	return NewPayloadBuilder(
+		NewHandleHTML(markdownDir, outputDir),
+		NewHandleCSS(filepath.Join(dir, "css"), outputDir+"/css", cssFileExtension),
+		NewHandleMarkdown(),
+		layoutHandler,
+		themeHandler,
+		NewHandleFeed(cfg.Site, cfg.Feed),
+		NewHandleSitemap(cfg.Site, cfg.Sitemap, cfg.Robots),
+		NewHandleAsset(""),
+		NewHandleRedirect(cfg.Site, filepath.Join(dir, DefaultRedirectsPath)),
+		"",
+	), markdownDir, outputDir
+}
+
+// renderTestSite renders the site of newTestBuilder.
+func renderTestSite(t *testing.T) []OutputFile {
+	t.Helper()
+	builder, markdownDir, outputDir := newTestBuilder(t)
+	files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+	require.NoError(t, err)
+	return files
+}
+
+func TestBuildPayload_RenderSite(t *testing.T) {
+	t.Run("should build bare markdown without a css directory", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		require.NoError(t, os.RemoveAll(filepath.Join(filepath.Dir(markdownDir), "css")))
+
+		files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+		require.NoError(t, err)
+		keys := make([]string, 0, len(files))
+		for _, file := range files {
+			keys = append(keys, file.Key)
+		}
+		assert.Contains(t, keys, "post.html")
+		assert.Contains(t, keys, IndexKey)
+	})
+
+	t.Run("should let a css file replace the theme css file with its key", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(markdownDir), "css", "theme.css"), []byte("body { color: red; }"), 0666))
+
+		files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+		require.NoError(t, err)
+		var themes []OutputFile
+		var page []byte
+		for _, file := range files {
+			switch file.Key {
+			case cssKeyPrefix + "theme.css":
+				themes = append(themes, file)
+			case "post.html":
+				page = file.Body
+			}
+		}
+		require.Len(t, themes, 1)
+		assert.Equal(t, "body{color:red}", string(themes[0].Body))
+		assert.Equal(t, 1, strings.Count(string(page), `href="css/theme.css"`))
+	})
+
+	t.Run("should only link tags that have an archive page", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		require.NoError(t, os.WriteFile(filepath.Join(markdownDir, "post.md"), []byte("---\ntags: [\"???\", Go]\n---\n# Post\n\nHello"), 0666))
+
+		files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+		require.NoError(t, err)
+		var page []byte
+		for _, file := range files {
+			if file.Key == "post.html" {
+				page = file.Body
+			}
+		}
+		assert.Contains(t, string(page), `href="tags/go/index.html"`)
+		assert.NotContains(t, string(page), `tags//index.html`)
+		assert.NotContains(t, string(page), `???`)
+	})
+
+	t.Run("should list static html pages in the sitemap", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		builder.sitemapHandler = NewHandleSitemap(config.Site{BaseURL: "https://blog.example.com"}, config.Sitemap{}, config.Robots{})
+		require.NoError(t, os.WriteFile(filepath.Join(markdownDir, "contact.html"), []byte("<p>contact</p>"), 0666))
+
+		files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+		require.NoError(t, err)
+		var sitemap []byte
+		for _, file := range files {
+			if file.Key == SitemapKey {
+				sitemap = file.Body
+			}
+		}
+		assert.Contains(t, string(sitemap), "<loc>https://blog.example.com/contact.html</loc>")
+		assert.Contains(t, string(sitemap), "<loc>https://blog.example.com/post.html</loc>")
+	})
+}
+
+func TestBuildPayload_BuildPayload(t *testing.T) {
+	t.Run("should write an artifact that loads back byte for byte", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		require.NoError(t, builder.BuildPayload(context.Background(), markdownDir, outputDir))
+
+		files, err := LoadArtifact(outputDir)
+		require.NoError(t, err)
+		rendered := renderTestSite(t)
+		require.Len(t, files, len(rendered))
+		for i := range rendered {
+			assert.Equal(t, rendered[i].Key, files[i].Key)
+			assert.Equal(t, rendered[i].ContentType, files[i].ContentType)
+			assert.Equal(t, string(rendered[i].Body), string(files[i].Body))
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package build
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+var ErrUnknownEncoding = errors.New("unknown compression")
+
+// compressibleTypes are the text formats worth compressing. Images, fonts and archives are
+// compressed already and are uploaded as they are.
+var compressibleTypes = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"application/json":       true,
+	"text/xml":               true,
+	"application/xml":        true,
+}
+
+// compressFiles returns outputFiles with every compressible file compressed with encoding. The
+// output only depends on the input, so the hash of a compressed file changes only when its
+// content does. An empty encoding returns outputFiles unchanged.
+func compressFiles(outputFiles []OutputFile, encoding string) ([]OutputFile, error) {
+	if encoding == "" {
+		return outputFiles, nil
+	}
+	if encoding != EncodingGzip && encoding != EncodingBrotli {
+		return nil, fmt.Errorf("%q, expected %s or %s: %w", encoding, EncodingGzip, EncodingBrotli, ErrUnknownEncoding)
+	}
+
+	compressed := make([]OutputFile, 0, len(outputFiles))
+	for _, outputFile := range outputFiles {
+		if outputFile.ContentEncoding != "" || !isCompressible(outputFile.ContentType) {
+			compressed = append(compressed, outputFile)
+			continue
+		}
+		body, err := compress(outputFile.Body, encoding)
+		if err != nil {
+			return nil, fmt.Errorf("error compressing %s: %w", outputFile.Key, err)
+		}
+		outputFile.Body = body
+		outputFile.ContentEncoding = encoding
+		compressed = append(compressed, outputFile)
+	}
+	return compressed, nil
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return compressibleTypes[mediaType] || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+func compress(body []byte, encoding string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case EncodingBrotli:
+		w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	default:
+		// the gzip header is left without a name or modification time, which would change the output
+		gw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = gw
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
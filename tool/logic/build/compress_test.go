@@ -0,0 +1,86 @@
+package build
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFiles(t *testing.T) {
+	page := bytes.Repeat([]byte("<p>hello</p>"), 100)
+	files := []OutputFile{
+		{Key: "index.html", ContentType: "text/html; charset=utf-8", Body: page},
+		{Key: "feed.xml", ContentType: contentTypeRSS, Body: page},
+		{Key: "logo.png", ContentType: "image/png", Body: page},
+	}
+
+	t.Run("should gzip text formats the same way every time", func(t *testing.T) {
+		first, err := compressFiles(files, EncodingGzip)
+		require.NoError(t, err)
+		second, err := compressFiles(files, EncodingGzip)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		for _, outputFile := range first[:2] {
+			assert.Equal(t, EncodingGzip, outputFile.ContentEncoding)
+			r, err := gzip.NewReader(bytes.NewReader(outputFile.Body))
+			require.NoError(t, err)
+			body, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, page, body)
+		}
+		assert.Equal(t, files[2], first[2])
+	})
+
+	t.Run("should compress with brotli", func(t *testing.T) {
+		compressed, err := compressFiles(files, EncodingBrotli)
+		require.NoError(t, err)
+		assert.Equal(t, EncodingBrotli, compressed[0].ContentEncoding)
+		body, err := io.ReadAll(brotli.NewReader(bytes.NewReader(compressed[0].Body)))
+		require.NoError(t, err)
+		assert.Equal(t, page, body)
+		assert.Less(t, len(compressed[0].Body), len(page))
+	})
+
+	t.Run("should leave files alone without an encoding and reject unknown ones", func(t *testing.T) {
+		same, err := compressFiles(files, "")
+		require.NoError(t, err)
+		assert.Equal(t, files, same)
+		_, err = compressFiles(files, "zstd")
+		assert.ErrorIs(t, err, ErrUnknownEncoding)
+	})
+}
+
+func TestPublisher_Deploy_compressed(t *testing.T) {
+	t.Run("should build compressed files, upload them as built and find nothing to upload the second time", func(t *testing.T) {
+		builder, markdownDir, outputDir := newTestBuilder(t)
+		builder.compression = EncodingGzip
+		files, err := builder.RenderSite(context.Background(), markdownDir, outputDir)
+		require.NoError(t, err)
+		require.NoError(t, WriteArtifact(outputDir, files))
+		files, err = LoadArtifact(outputDir)
+		require.NoError(t, err)
+
+		dest := target.NewMemory()
+		publisher := NewPublisher(config.Deploy{MaxPruneRatio: 1})
+
+		_, err = publisher.Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		post, ok := dest.Get("post.html")
+		require.True(t, ok)
+		assert.Equal(t, EncodingGzip, post.ContentEncoding)
+		assert.Equal(t, contentTypeHTML, post.ContentType)
+
+		plan, err := publisher.Plan(context.Background(), dest, files)
+		require.NoError(t, err)
+		assert.Empty(t, plan.Uploads())
+	})
+}
@@ -18,6 +18,8 @@ const cssTagTemplate = `
 <link rel="stylesheet" href="%s" />
 `
 
+const cssFileExtension = ".css"
+
 var _ CSSHandler = HandleCSS{}
 
 var ErrNoHeadTag = errors.New("no head tag in html")
@@ -32,6 +34,7 @@ type (
 		GetCSSDirectoryStructure(ctx context.Context) ([]string, error)
 		GetBuiltCSSFiles(ctx context.Context) ([]ReaderWithPath, error)
 		CreateBuildDirectoryForPath(context.Context, string) (string, error)
+		BuildPathFromSource(path string) string
 	}
 
 	HandleCSS struct {
@@ -79,7 +82,12 @@ func (c HandleCSS) InjectCSSIntoHTML(ctx context.Context, html io.Reader, cssPat
 	return []byte(result), nil
 }
 
+// GetCSSFilesFromSource returns every css file in the css directory. A missing directory is empty,
+// so a site of bare markdown builds with the theme stylesheets alone.
 func (c HandleCSS) GetCSSFilesFromSource(ctx context.Context) ([]ReaderWithPath, error) {
+	if _, err := os.Stat(c.cssSourceDirectory); os.IsNotExist(err) {
+		return []ReaderWithPath{}, nil
+	}
 	return getFilesFromDirectory(c.cssSourceDirectory, c.extension)
 }
 
@@ -119,6 +127,11 @@ func (c HandleCSS) CreateBuildFileFromCSSSource(ctx context.Context, path string
 	return cssFile, nil
 }
 
+// BuildPathFromSource returns the path a css source file is written to in the build directory.
+func (c HandleCSS) BuildPathFromSource(path string) string {
+	return c.buildDirFromPath(path)
+}
+
 func (c HandleCSS) buildDirFromPath(path string) string {
 	return strings.Replace(path, c.cssSourceDirectory, c.cssBuildDirectory, 1)
 }
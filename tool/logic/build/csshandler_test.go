@@ -13,7 +13,9 @@ import (
 )
 
 const testHTMLNoLines = `<html><head><head/><body></body></html>`
-const testHTMLNoLinesWant = `<html><head><link rel="stylesheet" href="./hello" /><head/><body></body></html>`
+const testHTMLNoLinesWant = `<html><head>
+<link rel="stylesheet" href="./hello" />
+<head/><body></body></html>`
 const testHTMLLines = `<html>
 <head><head/>
 <body></body>
@@ -0,0 +1,354 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+const (
+	RSSKey      = "feed.xml"
+	AtomKey     = "atom.xml"
+	JSONFeedKey = "feed.json"
+
+	contentTypeRSS      = "application/rss+xml"
+	contentTypeAtom     = "application/atom+xml"
+	contentTypeJSONFeed = "application/feed+json"
+
+	generator       = "github.com/rmarken5/blog-builder"
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+)
+
+var _ FeedHandler = HandleFeed{}
+
+// linkAttribute matches the href and src attributes of rendered html, holding the link in group 2.
+var linkAttribute = regexp.MustCompile(`(\s(?:href|src)=")([^"]*)(")`)
+
+type (
+	FeedHandler interface {
+		BuildFeeds(ctx context.Context, pages []Page) ([]OutputFile, error)
+	}
+
+	HandleFeed struct {
+		site config.Site
+		feed config.Feed
+	}
+
+	rss struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Atom    string     `xml:"xmlns:atom,attr"`
+		Channel rssChannel `xml:"channel"`
+	}
+	rssChannel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		Language      string    `xml:"language,omitempty"`
+		LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+		AtomLink      atomLink  `xml:"atom:link"`
+		Generator     string    `xml:"generator"`
+		Items         []rssItem `xml:"item"`
+	}
+	rssItem struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        string   `xml:"guid"`
+		PubDate     string   `xml:"pubDate,omitempty"`
+		Description string   `xml:"description"`
+		Categories  []string `xml:"category"`
+	}
+
+	atomFeed struct {
+		XMLName   xml.Name    `xml:"feed"`
+		Namespace string      `xml:"xmlns,attr"`
+		ID        string      `xml:"id"`
+		Title     string      `xml:"title"`
+		Subtitle  string      `xml:"subtitle,omitempty"`
+		Updated   string      `xml:"updated"`
+		Links     []atomLink  `xml:"link"`
+		Author    *atomAuthor `xml:"author,omitempty"`
+		Generator string      `xml:"generator"`
+		Entries   []atomEntry `xml:"entry"`
+	}
+	atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+		Type string `xml:"type,attr,omitempty"`
+	}
+	atomAuthor struct {
+		Name string `xml:"name"`
+	}
+	atomEntry struct {
+		ID         string         `xml:"id"`
+		Title      string         `xml:"title"`
+		Link       atomLink       `xml:"link"`
+		Published  string         `xml:"published,omitempty"`
+		Updated    string         `xml:"updated"`
+		Summary    *atomText      `xml:"summary,omitempty"`
+		Content    *atomText      `xml:"content,omitempty"`
+		Categories []atomCategory `xml:"category"`
+	}
+	atomText struct {
+		Type string `xml:"type,attr"`
+		Base string `xml:"xml:base,attr,omitempty"`
+		Body string `xml:",chardata"`
+	}
+	atomCategory struct {
+		Term string `xml:"term,attr"`
+	}
+
+	jsonFeed struct {
+		Version     string         `json:"version"`
+		Title       string         `json:"title"`
+		HomePageURL string         `json:"home_page_url"`
+		FeedURL     string         `json:"feed_url"`
+		Description string         `json:"description,omitempty"`
+		Language    string         `json:"language,omitempty"`
+		Authors     []jsonAuthor   `json:"authors,omitempty"`
+		Items       []jsonFeedItem `json:"items"`
+	}
+	jsonAuthor struct {
+		Name string `json:"name"`
+	}
+	jsonFeedItem struct {
+		ID            string   `json:"id"`
+		URL           string   `json:"url"`
+		Title         string   `json:"title"`
+		ContentHTML   string   `json:"content_html,omitempty"`
+		ContentText   string   `json:"content_text,omitempty"`
+		Summary       string   `json:"summary,omitempty"`
+		DatePublished string   `json:"date_published,omitempty"`
+		DateModified  string   `json:"date_modified,omitempty"`
+		Tags          []string `json:"tags,omitempty"`
+	}
+)
+
+func NewHandleFeed(site config.Site, feed config.Feed) *HandleFeed {
+	return &HandleFeed{
+		site: site,
+		feed: feed,
+	}
+}
+
+// BuildFeeds renders the RSS, Atom and JSON feeds for the most recent posts in pages.
+func (f HandleFeed) BuildFeeds(ctx context.Context, pages []Page) ([]OutputFile, error) {
+	if f.site.BaseURL == "" {
+		slog.Warn("site base_url is not set, feed links will be relative")
+	}
+
+	posts := sortedPosts(pages)
+	if f.feed.Limit > 0 && len(posts) > f.feed.Limit {
+		posts = posts[:f.feed.Limit]
+	}
+	updated := latestUpdate(posts)
+
+	rssBytes, err := f.rss(posts, updated)
+	if err != nil {
+		slog.Error("error building rss feed", "error", err)
+		return nil, err
+	}
+	atomBytes, err := f.atom(posts, updated)
+	if err != nil {
+		slog.Error("error building atom feed", "error", err)
+		return nil, err
+	}
+	jsonBytes, err := f.json(posts)
+	if err != nil {
+		slog.Error("error building json feed", "error", err)
+		return nil, err
+	}
+
+	return []OutputFile{
+		{Key: RSSKey, ContentType: contentTypeRSS, Body: rssBytes},
+		{Key: AtomKey, ContentType: contentTypeAtom, Body: atomBytes},
+		{Key: JSONFeedKey, ContentType: contentTypeJSONFeed, Body: jsonBytes},
+	}, nil
+}
+
+func (f HandleFeed) rss(posts []Page, updated time.Time) ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.site.Title,
+		Link:        f.url(IndexKey),
+		Description: f.site.Description,
+		Language:    f.site.Language,
+		AtomLink:    atomLink{Href: f.url(RSSKey), Rel: "self", Type: contentTypeRSS},
+		Generator:   generator,
+	}
+	if !updated.IsZero() {
+		channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+	for _, post := range posts {
+		item := rssItem{
+			Title:       post.Title,
+			Link:        f.url(post.Key),
+			GUID:        f.url(post.Key),
+			Description: f.content(post),
+			Categories:  post.Tags,
+		}
+		if !post.Created.IsZero() {
+			item.PubDate = post.Created.Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	return marshalXML(rss{Version: "2.0", Atom: atomNamespace, Channel: channel})
+}
+
+func (f HandleFeed) atom(posts []Page, updated time.Time) ([]byte, error) {
+	if updated.IsZero() {
+		// atom requires updated, so without any dates the newest markdown file stands in
+		updated = latestLastMod(posts)
+	}
+	feed := atomFeed{
+		Namespace: atomNamespace,
+		ID:        f.url(IndexKey),
+		Title:     f.site.Title,
+		Subtitle:  f.site.Description,
+		Updated:   updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.url(AtomKey), Rel: "self", Type: contentTypeAtom},
+			{Href: f.url(IndexKey), Rel: "alternate", Type: contentTypeHTML},
+		},
+		Generator: generator,
+	}
+	if f.site.Author != "" {
+		feed.Author = &atomAuthor{Name: f.site.Author}
+	}
+	for _, post := range posts {
+		entryUpdated := post.LastMod()
+		if entryUpdated.IsZero() {
+			entryUpdated = updated
+		}
+		entry := atomEntry{
+			ID:      f.url(post.Key),
+			Title:   post.Title,
+			Link:    atomLink{Href: f.url(post.Key), Rel: "alternate", Type: contentTypeHTML},
+			Updated: entryUpdated.Format(time.RFC3339),
+		}
+		if !post.Created.IsZero() {
+			entry.Published = post.Created.Format(time.RFC3339)
+		}
+		if f.feed.FullContent {
+			entry.Content = &atomText{Type: "html", Base: f.url(post.Key), Body: f.content(post)}
+		} else {
+			entry.Summary = &atomText{Type: "text", Body: f.content(post)}
+		}
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalXML(feed)
+}
+
+func (f HandleFeed) json(posts []Page) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.site.Title,
+		HomePageURL: f.url(IndexKey),
+		FeedURL:     f.url(JSONFeedKey),
+		Description: f.site.Description,
+		Language:    f.site.Language,
+		Items:       make([]jsonFeedItem, 0, len(posts)),
+	}
+	if f.site.Author != "" {
+		feed.Authors = []jsonAuthor{{Name: f.site.Author}}
+	}
+	for _, post := range posts {
+		item := jsonFeedItem{
+			ID:    f.url(post.Key),
+			URL:   f.url(post.Key),
+			Title: post.Title,
+			Tags:  post.Tags,
+		}
+		if f.feed.FullContent {
+			item.ContentHTML = f.content(post)
+			item.Summary = post.Excerpt
+		} else {
+			item.ContentText = post.Excerpt
+		}
+		// an item needs content_html or content_text, so a post without either carries its title
+		if item.ContentHTML == "" && item.ContentText == "" {
+			item.ContentText = post.Title
+		}
+		if !post.Created.IsZero() {
+			item.DatePublished = post.Created.Format(time.RFC3339)
+		}
+		if !post.Updated.IsZero() {
+			item.DateModified = post.Updated.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// content is what a feed entry carries: the html of the whole post with its links made absolute,
+// or only the plain text excerpt.
+func (f HandleFeed) content(post Page) string {
+	if f.feed.FullContent {
+		return absoluteLinks(string(post.Content), f.url(post.Key))
+	}
+	return post.Excerpt
+}
+
+func (f HandleFeed) url(key string) string {
+	return absoluteURL(f.site.BaseURL, key)
+}
+
+// absoluteLinks resolves the relative href and src links of content against base, the url of the
+// page it belongs to, since feed readers show it away from the site. Without an absolute base the
+// links are left as they are.
+func absoluteLinks(content, base string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		return content
+	}
+	return linkAttribute.ReplaceAllStringFunc(content, func(attribute string) string {
+		parts := linkAttribute.FindStringSubmatch(attribute)
+		link, err := url.Parse(parts[2])
+		if err != nil || link.IsAbs() {
+			return attribute
+		}
+		return parts[1] + baseURL.ResolveReference(link).String() + parts[3]
+	})
+}
+
+// latestUpdate is the most recent created or updated date of the posts. The feeds use it instead
+// of the build time so that an unchanged site produces byte-identical feeds.
+func latestUpdate(posts []Page) time.Time {
+	latest := time.Time{}
+	for _, post := range posts {
+		if updated := postUpdated(post, time.Time{}); updated.After(latest) {
+			latest = updated
+		}
+	}
+	return latest
+}
+
+func postUpdated(post Page, fallback time.Time) time.Time {
+	switch {
+	case !post.Updated.IsZero():
+		return post.Updated
+	case !post.Created.IsZero():
+		return post.Created
+	}
+	return fallback
+}
+
+func marshalXML(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
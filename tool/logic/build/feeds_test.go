@@ -0,0 +1,134 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFeedPages() []Page {
+	return []Page{
+		{Key: "old.html", Content: "<p>old body</p>", Excerpt: "old", FrontMatter: FrontMatter{Title: "Old", Created: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{Key: "posts/new.html", Content: `<p>new <a href="../old.html">body</a><img src="new.png" alt="new"></p>`, Excerpt: "new", FrontMatter: FrontMatter{
+			Title:   "New",
+			Tags:    []string{"go"},
+			Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Updated: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{Key: "about.html", FrontMatter: FrontMatter{Title: "About", Layout: ListLayout}},
+	}
+}
+
+func TestHandleFeed_BuildFeeds(t *testing.T) {
+	site := config.Site{Title: "Test Blog", BaseURL: "https://blog.example.com/"}
+
+	t.Run("should write rss, atom and json feeds with content types", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{Limit: 1}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+		require.Len(t, files, 3)
+
+		assert.Equal(t, RSSKey, files[0].Key)
+		assert.Equal(t, "application/rss+xml", files[0].ContentType)
+		assert.Equal(t, AtomKey, files[1].Key)
+		assert.Equal(t, "application/atom+xml", files[1].ContentType)
+		assert.Equal(t, JSONFeedKey, files[2].Key)
+		assert.Equal(t, "application/feed+json", files[2].ContentType)
+	})
+	t.Run("should limit rss items to the most recent posts", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{Limit: 1}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+
+		var feed rss
+		require.NoError(t, xml.Unmarshal(files[0].Body, &feed))
+		require.Len(t, feed.Channel.Items, 1)
+		item := feed.Channel.Items[0]
+		assert.Equal(t, "New", item.Title)
+		assert.Equal(t, "https://blog.example.com/posts/new.html", item.Link)
+		assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 +0000", item.PubDate)
+		assert.Equal(t, "new", item.Description)
+		assert.Equal(t, []string{"go"}, item.Categories)
+	})
+	t.Run("should carry full content and updated dates in atom", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{FullContent: true}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+
+		var feed atomFeed
+		require.NoError(t, xml.Unmarshal(files[1].Body, &feed))
+		assert.Equal(t, "2024-02-01T00:00:00Z", feed.Updated)
+		require.Len(t, feed.Entries, 2)
+		assert.Equal(t, "2024-02-01T00:00:00Z", feed.Entries[0].Updated)
+		assert.Equal(t, "2024-01-01T00:00:00Z", feed.Entries[0].Published)
+		require.NotNil(t, feed.Entries[0].Content)
+		assert.Equal(t, "html", feed.Entries[0].Content.Type)
+		assert.Equal(t, `<p>new <a href="https://blog.example.com/old.html">body</a><img src="https://blog.example.com/posts/new.png" alt="new"></p>`, feed.Entries[0].Content.Body)
+		assert.Equal(t, []atomCategory{{Term: "go"}}, feed.Entries[0].Categories)
+	})
+	t.Run("should write a json feed", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+
+		var feed jsonFeed
+		require.NoError(t, json.Unmarshal(files[2].Body, &feed))
+		assert.Equal(t, jsonFeedVersion, feed.Version)
+		assert.Equal(t, "https://blog.example.com/feed.json", feed.FeedURL)
+		require.Len(t, feed.Items, 2)
+		assert.Equal(t, "new", feed.Items[0].ContentText)
+		assert.Equal(t, "2024-02-01T00:00:00Z", feed.Items[0].DateModified)
+	})
+	t.Run("should mark excerpts as text in atom", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+
+		var feed atomFeed
+		require.NoError(t, xml.Unmarshal(files[1].Body, &feed))
+		require.NotNil(t, feed.Entries[0].Summary)
+		assert.Equal(t, atomText{Type: "text", Body: "new"}, *feed.Entries[0].Summary)
+	})
+	t.Run("should make the links of full content absolute in rss and json", func(t *testing.T) {
+		files, err := NewHandleFeed(site, config.Feed{FullContent: true}).BuildFeeds(context.Background(), testFeedPages())
+		require.NoError(t, err)
+
+		var rssFeed rss
+		require.NoError(t, xml.Unmarshal(files[0].Body, &rssFeed))
+		assert.Contains(t, rssFeed.Channel.Items[0].Description, `href="https://blog.example.com/old.html"`)
+		var feed jsonFeed
+		require.NoError(t, json.Unmarshal(files[2].Body, &feed))
+		assert.Contains(t, feed.Items[0].ContentHTML, `src="https://blog.example.com/posts/new.png"`)
+	})
+	t.Run("should fall back to the title for json items without an excerpt", func(t *testing.T) {
+		pages := []Page{{Key: "image.html", FrontMatter: FrontMatter{Title: "Only an image"}}}
+		files, err := NewHandleFeed(site, config.Feed{}).BuildFeeds(context.Background(), pages)
+		require.NoError(t, err)
+
+		var feed jsonFeed
+		require.NoError(t, json.Unmarshal(files[2].Body, &feed))
+		require.Len(t, feed.Items, 1)
+		assert.Equal(t, "Only an image", feed.Items[0].ContentText)
+	})
+	t.Run("should date atom by the markdown files when no post has a date", func(t *testing.T) {
+		pages := []Page{
+			{Key: "a.html", Modified: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), FrontMatter: FrontMatter{Title: "A"}},
+			{Key: "b.html", Modified: time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC), FrontMatter: FrontMatter{Title: "B"}},
+		}
+		files, err := NewHandleFeed(site, config.Feed{}).BuildFeeds(context.Background(), pages)
+		require.NoError(t, err)
+
+		var feed atomFeed
+		require.NoError(t, xml.Unmarshal(files[1].Body, &feed))
+		assert.Equal(t, "2024-06-01T08:00:00Z", feed.Updated)
+		updated := make(map[string]string)
+		for _, entry := range feed.Entries {
+			updated[entry.Title] = entry.Updated
+		}
+		assert.Equal(t, map[string]string{"A": "2024-05-01T08:00:00Z", "B": "2024-06-01T08:00:00Z"}, updated)
+	})
+	t.Run("should leave links relative without a base url", func(t *testing.T) {
+		assert.Equal(t, `<a href="../old.html">old</a>`, absoluteLinks(`<a href="../old.html">old</a>`, "posts/new.html"))
+	})
+}
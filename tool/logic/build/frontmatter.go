@@ -0,0 +1,229 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	yamlFence = "---"
+	tomlFence = "+++"
+	jsonOpen  = "{"
+)
+
+// dateLayouts are tried in order when a front matter date is given as a string.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+var ErrInvalidFrontMatter = errors.New("invalid front matter")
+
+type (
+	FrontMatterFormat string
+
+	// FrontMatter is the typed page model read from the block at the top of a markdown file.
+	// Keys that are not known fields are kept in Custom so templates can still read them.
+	FrontMatter struct {
+		Format      FrontMatterFormat
+		Title       string
+		Description string
+		Tags        []string
+		Created     time.Time
+		Updated     time.Time
+		Layout      string
+		Aliases     []string
+		Custom      map[string]any
+	}
+)
+
+const (
+	FrontMatterNone FrontMatterFormat = ""
+	FrontMatterYAML FrontMatterFormat = "yaml"
+	FrontMatterTOML FrontMatterFormat = "toml"
+	FrontMatterJSON FrontMatterFormat = "json"
+)
+
+// ParseFrontMatter reads a markdown document and returns its front matter along with the remaining body.
+func ParseFrontMatter(_ context.Context, r io.Reader) (FrontMatter, []byte, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return FrontMatter{}, nil, err
+	}
+
+	format, raw, body, err := splitFrontMatter(src)
+	if err != nil {
+		return FrontMatter{}, nil, err
+	}
+
+	fields := make(map[string]any)
+	switch format {
+	case FrontMatterYAML:
+		err = yaml.Unmarshal(raw, &fields)
+	case FrontMatterTOML:
+		err = toml.Unmarshal(raw, &fields)
+	case FrontMatterJSON:
+		err = json.Unmarshal(raw, &fields)
+	}
+	if err != nil {
+		return FrontMatter{}, nil, fmt.Errorf("error decoding %s front matter: %w - %w", format, err, ErrInvalidFrontMatter)
+	}
+
+	fm, err := newFrontMatter(format, fields)
+	if err != nil {
+		return FrontMatter{}, nil, err
+	}
+	return fm, body, nil
+}
+
+// splitFrontMatter separates the front matter block at the start of src from the body.
+// Only a fence on the very first line opens front matter, so rules, setext headings and
+// tables further down the document are returned in the body untouched.
+func splitFrontMatter(src []byte) (FrontMatterFormat, []byte, []byte, error) {
+	doc := bytes.TrimPrefix(src, utf8BOM)
+	first, _ := nextLine(doc)
+	switch {
+	case isFence(first, yamlFence):
+		return splitFenced(FrontMatterYAML, yamlFence, src, doc)
+	case isFence(first, tomlFence):
+		return splitFenced(FrontMatterTOML, tomlFence, src, doc)
+	case bytes.HasPrefix(doc, []byte(jsonOpen)):
+		dec := json.NewDecoder(bytes.NewReader(doc))
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return "", nil, nil, fmt.Errorf("error decoding json front matter: %w - %w", err, ErrInvalidFrontMatter)
+		}
+		_, n := nextLine(doc[dec.InputOffset():])
+		return FrontMatterJSON, raw, doc[dec.InputOffset()+int64(n):], nil
+	}
+	return FrontMatterNone, nil, src, nil
+}
+
+// splitFenced looks for the closing fence of a block opened on the first line of doc. A block
+// that is never closed is not front matter and the original source is returned as the body.
+func splitFenced(format FrontMatterFormat, fence string, src, doc []byte) (FrontMatterFormat, []byte, []byte, error) {
+	_, n := nextLine(doc)
+	rest := doc[n:]
+	for offset := 0; offset < len(rest); {
+		line, n := nextLine(rest[offset:])
+		if isFence(line, fence) {
+			return format, rest[:offset], rest[offset+n:], nil
+		}
+		offset += n
+	}
+	return FrontMatterNone, nil, src, nil
+}
+
+// nextLine returns the first line of b without its line ending and the number of bytes it spans.
+func nextLine(b []byte) ([]byte, int) {
+	i := bytes.IndexByte(b, '\n')
+	if i == -1 {
+		return b, len(b)
+	}
+	return b[:i], i + 1
+}
+
+func isFence(line []byte, fence string) bool {
+	return string(bytes.TrimRight(line, " \t\r")) == fence
+}
+
+func newFrontMatter(format FrontMatterFormat, fields map[string]any) (FrontMatter, error) {
+	fm := FrontMatter{
+		Format: format,
+		Custom: make(map[string]any),
+	}
+	var err error
+	for key, value := range fields {
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title, err = toString(value)
+		case "description":
+			fm.Description, err = toString(value)
+		case "tags":
+			fm.Tags, err = toStringSlice(value)
+		case "created", "date":
+			fm.Created, err = toTime(value)
+		case "updated", "lastmod":
+			fm.Updated, err = toTime(value)
+		case "layout":
+			fm.Layout, err = toString(value)
+		case "aliases":
+			fm.Aliases, err = toStringSlice(value)
+		default:
+			fm.Custom[key] = value
+		}
+		if err != nil {
+			return FrontMatter{}, fmt.Errorf("error reading front matter key %q: %w - %w", key, err, ErrInvalidFrontMatter)
+		}
+	}
+	return fm, nil
+}
+
+// toString returns a text value, treating an empty value such as `title:` as unset.
+func toString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("unsupported text value %v, quote it to use it as text", value)
+}
+
+func toStringSlice(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		tags := make([]string, 0)
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags, nil
+	case []any:
+		tags := make([]string, 0, len(v))
+		for _, tag := range v {
+			tags = append(tags, fmt.Sprint(tag))
+		}
+		return tags, nil
+	}
+	return nil, fmt.Errorf("unsupported list value %v", value)
+}
+
+// localZones are the zones toml gives dates and times written without an offset.
+var localZones = []string{"datetime-local", "date-local", "time-local"}
+
+func toTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		// a local date is read as UTC, the same as a date given as a string
+		if name, _ := v.Zone(); slices.Contains(localZones, name) {
+			return time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC), nil
+		}
+		return v, nil
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported date value %v", value)
+}
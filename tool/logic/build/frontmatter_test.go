@@ -0,0 +1,113 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testYAMLFrontMatter = `---
+title: Hello World
+description: A first post
+tags:
+  - go
+  - aws
+created: 2024-03-01 09:30
+aliases:
+  - /2024/hello-world/
+series:
+  name: getting started
+  part: 1
+---
+# Hello
+`
+
+const testTOMLFrontMatter = `+++
+title = "Hello World"
+tags = ["go", "aws"]
+created = 2024-03-01T09:30:00Z
+series = "getting started"
++++
+# Hello
+`
+
+const testJSONFrontMatter = `{
+  "title": "Hello World",
+  "tags": ["go", "aws"],
+  "created": "2024-03-01T09:30:00Z",
+  "series": "getting started"
+}
+# Hello
+`
+
+func TestParseFrontMatter(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	t.Run("should parse yaml front matter", func(t *testing.T) {
+		fm, body, err := ParseFrontMatter(context.Background(), strings.NewReader(testYAMLFrontMatter))
+		require.NoError(t, err)
+		assert.Equal(t, FrontMatterYAML, fm.Format)
+		assert.Equal(t, "Hello World", fm.Title)
+		assert.Equal(t, "A first post", fm.Description)
+		assert.Equal(t, []string{"go", "aws"}, fm.Tags)
+		assert.Equal(t, []string{"/2024/hello-world/"}, fm.Aliases)
+		assert.True(t, created.Equal(fm.Created))
+		assert.Equal(t, map[string]any{"name": "getting started", "part": 1}, fm.Custom["series"])
+		assert.Equal(t, "# Hello\n", string(body))
+	})
+	t.Run("should parse toml front matter", func(t *testing.T) {
+		fm, body, err := ParseFrontMatter(context.Background(), strings.NewReader(testTOMLFrontMatter))
+		require.NoError(t, err)
+		assert.Equal(t, FrontMatterTOML, fm.Format)
+		assert.Equal(t, "Hello World", fm.Title)
+		assert.Equal(t, []string{"go", "aws"}, fm.Tags)
+		assert.True(t, created.Equal(fm.Created))
+		assert.Equal(t, "getting started", fm.Custom["series"])
+		assert.Equal(t, "# Hello\n", string(body))
+	})
+	t.Run("should parse json front matter", func(t *testing.T) {
+		fm, body, err := ParseFrontMatter(context.Background(), strings.NewReader(testJSONFrontMatter))
+		require.NoError(t, err)
+		assert.Equal(t, FrontMatterJSON, fm.Format)
+		assert.Equal(t, "Hello World", fm.Title)
+		assert.Equal(t, []string{"go", "aws"}, fm.Tags)
+		assert.True(t, created.Equal(fm.Created))
+		assert.Equal(t, "getting started", fm.Custom["series"])
+		assert.Equal(t, "# Hello\n", string(body))
+	})
+	t.Run("should return body when there is no front matter", func(t *testing.T) {
+		fm, body, err := ParseFrontMatter(context.Background(), strings.NewReader("# Start here\n"))
+		require.NoError(t, err)
+		assert.Equal(t, FrontMatterNone, fm.Format)
+		assert.Empty(t, fm.Tags)
+		assert.Equal(t, "# Start here\n", string(body))
+	})
+	t.Run("should error on invalid date", func(t *testing.T) {
+		_, _, err := ParseFrontMatter(context.Background(), strings.NewReader("---\ncreated: yesterday\n---\n"))
+		assert.ErrorIs(t, err, ErrInvalidFrontMatter)
+	})
+	t.Run("should read toml local dates as utc", func(t *testing.T) {
+		fm, _, err := ParseFrontMatter(context.Background(), strings.NewReader("+++\ndate = 2024-04-01\nupdated = 2024-04-02T10:15:00\n+++\n"))
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), fm.Created)
+		assert.Equal(t, time.Date(2024, 4, 2, 10, 15, 0, 0, time.UTC), fm.Updated)
+		assert.Equal(t, "Monday, 01-Apr-24 00:00:00 UTC", fm.Created.Format(time.RFC850))
+	})
+	t.Run("should treat empty text values as unset", func(t *testing.T) {
+		fm, _, err := ParseFrontMatter(context.Background(), strings.NewReader("---\ntitle:\ndescription:\nlayout:\n---\n"))
+		require.NoError(t, err)
+		assert.Empty(t, fm.Title)
+		assert.Empty(t, fm.Description)
+		assert.Empty(t, fm.Layout)
+	})
+	t.Run("should error on text values that are not text", func(t *testing.T) {
+		for _, doc := range []string{"---\ntitle: [a, b]\n---\n", "---\nlayout: 3\n---\n"} {
+			_, _, err := ParseFrontMatter(context.Background(), strings.NewReader(doc))
+			assert.ErrorIs(t, err, ErrInvalidFrontMatter, doc)
+		}
+	})
+}
@@ -1,11 +1,8 @@
 package build
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	_ "embed"
-	"html/template"
 	"io"
 	"log"
 	"log/slog"
@@ -14,16 +11,11 @@ import (
 	"strings"
 
 	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
 )
 
-//go:embed templates/html-metadata-tags.html
-var tagTemplate string
-
-//go:embed templates/html-metadata-created-at.html
-var createdAtTemplate string
-
 var _ HTMLHandler = HandleHTML{}
 
 const HTMLFileExtension = ".html"
@@ -88,22 +80,69 @@ func (h HandleHTML) buildDirFromPath(path string) string {
 	return strings.Replace(path, h.markdownPath, h.buildOutputPath, 1)
 }
 
-const generatorTag = `  <meta name="GENERATOR" content="github.com/rmarken5/blog-builder`
-
+// mdToHTML renders the markdown body only; the surrounding document comes from the layouts.
 func mdToHTML(md []byte) []byte {
-	// create markdown parser with extensions
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
-	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(md)
+	doc := parseMarkdown(md)
 
 	// create HTML renderer with extensions
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank | html.CompletePage
-	opts := html.RendererOptions{Flags: htmlFlags, Generator: generatorTag}
+	htmlFlags := html.CommonFlags | html.HrefTargetBlank
+	opts := html.RendererOptions{Flags: htmlFlags}
 	renderer := html.NewRenderer(opts)
 
 	return markdown.Render(doc, renderer)
 }
 
+func parseMarkdown(md []byte) ast.Node {
+	// create markdown parser with extensions
+	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
+	p := parser.NewWithExtensions(extensions)
+	return p.Parse(md)
+}
+
+// TitleFromMarkdown returns the text of the first level one heading, used when front matter has no title.
+func TitleFromMarkdown(md []byte) string {
+	title := ""
+	ast.WalkFunc(parseMarkdown(md), func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.Level != 1 {
+			return ast.GoToNext
+		}
+		title = nodeText(heading)
+		return ast.Terminate
+	})
+	return title
+}
+
+// ExcerptFromMarkdown returns the text of the first paragraph, cut to at most words words.
+func ExcerptFromMarkdown(md []byte, words int) string {
+	excerpt := ""
+	ast.WalkFunc(parseMarkdown(md), func(node ast.Node, entering bool) ast.WalkStatus {
+		paragraph, ok := node.(*ast.Paragraph)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		excerpt = nodeText(paragraph)
+		return ast.Terminate
+	})
+
+	fields := strings.Fields(excerpt)
+	if len(fields) <= words {
+		return strings.Join(fields, " ")
+	}
+	return strings.Join(fields[:words], " ") + "…"
+}
+
+func nodeText(root ast.Node) string {
+	var sb strings.Builder
+	ast.WalkFunc(root, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); entering && leaf != nil {
+			sb.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.TrimSpace(sb.String())
+}
+
 func (h HandleHTML) CreateBuildDirectoryForPath(ctx context.Context, filePath string) (string, error) {
 	fullPath := strings.Replace(filePath, h.markdownPath, h.buildOutputPath, 1)
 	err := os.Mkdir(fullPath, 0777)
@@ -181,37 +220,3 @@ func isLocalLink(href string) bool {
 
 	return true
 }
-
-type Metadata struct {
-	Tags      []string
-	CreatedAt string
-}
-
-func InjectMetadataHeader(ctx context.Context, r io.Reader, metadata Metadata) ([]byte, error) {
-	bufWritter := bytes.NewBuffer([]byte{})
-	scanner := bufio.NewScanner(r)
-	bodyStart := "<body>"
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		bufWritter.Write(b)
-		if strings.Contains(string(b), bodyStart) {
-			t, err := template.New("").Parse(createdAtTemplate)
-			if err != nil {
-				return nil, err
-			}
-			err = t.ExecuteTemplate(bufWritter, "", metadata)
-			if err != nil {
-				return nil, err
-			}
-			t, err = template.New("").Parse(tagTemplate)
-			if err != nil {
-				return nil, err
-			}
-			err = t.ExecuteTemplate(bufWritter, "", metadata)
-			if err != nil {
-				return nil, err
-			}
-		}
-	}
-	return bufWritter.Bytes(), nil
-}
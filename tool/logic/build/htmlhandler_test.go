@@ -1,6 +1,7 @@
 package build
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,8 +9,19 @@ import (
 
 func TestHandleHTML_GetHTMLFilesFromBuildPath(t *testing.T) {
 	t.Run("check files", func(t *testing.T) {
-		path, err := HandleHTML{fileExtension: ".html"}.GetHTMLFilesFromBuildPath("./test-files")
+		path, err := HandleHTML{fileExtension: ".html"}.GetHTMLFilesFromBuildPath(context.Background(), "./test-files")
 		assert.NoError(t, err)
 		assert.Len(t, path, 1)
 	})
 }
+
+func TestExcerptFromMarkdown(t *testing.T) {
+	t.Run("should use the first paragraph", func(t *testing.T) {
+		excerpt := ExcerptFromMarkdown([]byte("# Title\n\nFirst *paragraph* with a [link](a.md).\n\nSecond paragraph.\n"), 40)
+		assert.Equal(t, "First paragraph with a link.", excerpt)
+	})
+	t.Run("should cut long paragraphs", func(t *testing.T) {
+		excerpt := ExcerptFromMarkdown([]byte("one two three four five\n"), 3)
+		assert.Equal(t, "one two three…", excerpt)
+	})
+}
@@ -0,0 +1,121 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"strings"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+const (
+	DefaultLayout   = "post"
+	ListLayout      = "list"
+	baseLayout      = "base.html"
+	partialsPattern = "partials/*.html"
+)
+
+var ErrUnknownLayout = errors.New("unknown layout")
+
+var templateFuncs = template.FuncMap{
+	"slugify": Slugify,
+}
+
+var _ LayoutHandler = HandleLayout{}
+
+type (
+	LayoutHandler interface {
+		RenderPage(ctx context.Context, layout string, data PageData) ([]byte, error)
+	}
+
+	HandleLayout struct {
+		site    config.Site
+		layouts map[string]*template.Template
+	}
+
+	// PageData is what every layout is executed with.
+	PageData struct {
+		Site        config.Site
+		Page        Page
+		Pages       []Page
+		Tags        []Tag
+		Content     template.HTML
+		Root        string
+		Stylesheets []string
+	}
+)
+
+// NewHandleLayout parses base.html, the partials and every other layout found in layoutFS.
+func NewHandleLayout(layoutFS fs.FS, site config.Site) (*HandleLayout, error) {
+	layouts, err := parseLayouts(layoutFS)
+	if err != nil {
+		slog.Error("error parsing layouts", "error", err)
+		return nil, err
+	}
+
+	return &HandleLayout{
+		site:    site,
+		layouts: layouts,
+	}, nil
+}
+
+func (l HandleLayout) RenderPage(ctx context.Context, layout string, data PageData) ([]byte, error) {
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	t, ok := l.layouts[layout]
+	if !ok {
+		return nil, fmt.Errorf("layout %q: %w", layout, ErrUnknownLayout)
+	}
+
+	data.Site = l.site
+	buf := bytes.NewBuffer([]byte{})
+	if err := t.ExecuteTemplate(buf, baseLayout, data); err != nil {
+		slog.Error("error executing layout", "layout", layout, "error", err)
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ForPage returns a copy of the data focused on page, letting list layouts reuse the post partials.
+func (d PageData) ForPage(page Page) PageData {
+	d.Page = page
+	d.Content = page.Content
+	return d
+}
+
+// parseLayouts builds one template set per layout file, each made of base.html, the partials
+// and the layout itself so that layouts can redefine the blocks declared in base.html.
+func parseLayouts(layoutFS fs.FS) (map[string]*template.Template, error) {
+	base, err := template.New(baseLayout).Funcs(templateFuncs).ParseFS(layoutFS, baseLayout, partialsPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := fs.Glob(layoutFS, "*"+HTMLFileExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := make(map[string]*template.Template)
+	for _, name := range names {
+		if name == baseLayout {
+			continue
+		}
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		t, err = t.ParseFS(layoutFS, name)
+		if err != nil {
+			return nil, err
+		}
+		layouts[strings.TrimSuffix(name, HTMLFileExtension)] = t
+	}
+	return layouts, nil
+}
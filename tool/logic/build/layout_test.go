@@ -0,0 +1,66 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLayout_RenderPage(t *testing.T) {
+	site := config.Site{Title: "Test Blog", Language: "en"}
+
+	t.Run("should render post with the default theme", func(t *testing.T) {
+		theme, err := NewHandleTheme("", "")
+		require.NoError(t, err)
+		l, err := NewHandleLayout(theme.Layouts(), site)
+		require.NoError(t, err)
+
+		html, err := l.RenderPage(context.Background(), "", PageData{
+			Page: Page{FrontMatter: FrontMatter{
+				Title:   "Hello",
+				Tags:    []string{"go", "aws"},
+				Created: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+			}},
+			Content:     "<p>body</p>",
+			Root:        "../",
+			Stylesheets: []string{"../css/main.css"},
+		})
+		require.NoError(t, err)
+		assert.Contains(t, string(html), "<title>Hello | Test Blog</title>")
+		assert.Contains(t, string(html), `<link rel="stylesheet" href="../css/main.css" />`)
+		assert.Contains(t, string(html), `datetime="2024-03-01T09:30:00Z"`)
+		assert.Contains(t, string(html), `class="tag">go</a>`)
+		assert.Contains(t, string(html), "<p>body</p>")
+	})
+	t.Run("should error on unknown layout", func(t *testing.T) {
+		theme, err := NewHandleTheme("", "")
+		require.NoError(t, err)
+		l, err := NewHandleLayout(theme.Layouts(), site)
+		require.NoError(t, err)
+
+		_, err = l.RenderPage(context.Background(), "nope", PageData{})
+		assert.ErrorIs(t, err, ErrUnknownLayout)
+	})
+	t.Run("should use layouts and partials from directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "partials"), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "base.html"), []byte(`{{ block "main" . }}{{ end }}{{ template "footer.html" . }}`), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "partials", "footer.html"), []byte(`|{{ .Site.Title }}`), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "note.html"), []byte(`{{ define "main" }}note:{{ .Content }}{{ end }}`), 0666))
+
+		theme, err := NewHandleTheme("", dir)
+		require.NoError(t, err)
+		l, err := NewHandleLayout(theme.Layouts(), site)
+		require.NoError(t, err)
+
+		html, err := l.RenderPage(context.Background(), "note", PageData{Content: "hi"})
+		require.NoError(t, err)
+		assert.Equal(t, "note:hi|Test Blog", string(html))
+	})
+}
@@ -1,26 +1,17 @@
 package build
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"io"
-	"strings"
 	"time"
 )
 
-const (
-	metadataBrace         = "---"
-	tagBullet             = "  - "
-	markdownFileExtension = ".md"
-)
+const markdownFileExtension = ".md"
 
 var _ MarkdownHandler = HandleMarkdown{}
 
 type (
-	TagFinder       func(s *bufio.Scanner) ([]string, error)
-	CreatedAtFinder func(s *bufio.Scanner) (time.Time, error)
-	ReaderWithPath  struct {
+	ReaderWithPath struct {
 		Path   string
 		Reader io.ReadCloser
 	}
@@ -46,100 +37,29 @@ func (m HandleMarkdown) GetMarkdownDirectoryStructure(ctx context.Context, path
 	return getDirectoryStructure(path)
 }
 
-func GetTags(_ context.Context, r io.Reader, tagFinder TagFinder) ([]string, error) {
-	scanner := bufio.NewScanner(r)
-	tags, err := tagFinder(scanner)
+// GetTags returns the tags listed in the front matter of a markdown document.
+func GetTags(ctx context.Context, r io.Reader) ([]string, error) {
+	fm, _, err := ParseFrontMatter(ctx, r)
 	if err != nil {
 		return nil, err
 	}
-	return tags, nil
+	return fm.Tags, nil
 }
 
-func GetCreatedAtDate(ctx context.Context, r io.Reader, createdAtFinder CreatedAtFinder) (time.Time, error) {
-	scanner := bufio.NewScanner(r)
-	createdAt, err := createdAtFinder(scanner)
+// GetCreatedAtDate returns the created date from the front matter of a markdown document.
+func GetCreatedAtDate(ctx context.Context, r io.Reader) (time.Time, error) {
+	fm, _, err := ParseFrontMatter(ctx, r)
 	if err != nil {
 		return time.Time{}, err
 	}
-	return createdAt, nil
-}
-
-func findTags(s *bufio.Scanner) ([]string, error) {
-	metadataStart := false
-	tagsStart := false
-	tags := make([]string, 0)
-	for s.Scan() {
-		line := s.Text()
-		if strings.Contains(line, metadataBrace) {
-			metadataStart = !metadataStart
-			if !metadataStart {
-				break
-			}
-			continue
-		}
-		if metadataStart {
-			if tagsStart {
-				if !strings.HasPrefix(line, tagBullet) {
-					tagsStart = false
-					continue
-				}
-				tag := strings.TrimPrefix(line, tagBullet)
-				tags = append(tags, tag)
-				continue
-			}
-			if strings.Contains(line, "tags:") {
-				tagsStart = true
-				continue
-			}
-		}
-	}
-	if s.Err() != nil {
-		return nil, s.Err()
-	}
-	return tags, nil
-}
-
-func findCreatedAt(s *bufio.Scanner) (time.Time, error) {
-	var err error
-	var createdAt time.Time
-	for s.Scan() {
-		line := s.Text()
-		if strings.HasPrefix(line, "created:") {
-			timeString := strings.TrimSpace(strings.TrimPrefix(line, "created: "))
-			createdAt, err = time.Parse("2006-01-02 15:04", timeString)
-			if err != nil {
-				return time.Time{}, err
-			}
-			break
-		}
-	}
-	if s.Err() != nil {
-		return time.Time{}, s.Err()
-	}
-	return createdAt, nil
+	return fm.Created, nil
 }
 
+// RemoveMetaData returns the markdown document with its front matter removed.
 func RemoveMetaData(ctx context.Context, r io.Reader) ([]byte, error) {
-	scanner := bufio.NewScanner(r)
-	f := make([]byte, 0)
-	bWriter := bytes.NewBuffer(f)
-
-	metadataStart := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, metadataBrace) {
-			metadataStart = !metadataStart
-			continue
-		}
-		if metadataStart {
-			continue
-		}
-		if _, err := bWriter.WriteString(line); err != nil {
-			return nil, err
-		}
-	}
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+	_, body, err := ParseFrontMatter(ctx, r)
+	if err != nil {
+		return nil, err
 	}
-	return bWriter.Bytes(), nil
+	return body, nil
 }
@@ -0,0 +1,112 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBodyWithRules = `# Title
+
+First paragraph.
+
+---
+
+Second paragraph.
+
+Setext Heading
+--------------
+
+| Column A | Column B |
+| --- | --- |
+| 1 | 2 |
+
+***
+`
+
+func TestRemoveMetaData(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{
+			name: "should keep horizontal rules, setext headings and tables after front matter",
+			md:   "---\ntitle: rules\ntags:\n  - go\n---\n" + testBodyWithRules,
+			want: testBodyWithRules,
+		},
+		{
+			name: "should keep body byte for byte without front matter",
+			md:   testBodyWithRules,
+			want: testBodyWithRules,
+		},
+		{
+			name: "should treat a leading rule without a closing fence as body",
+			md:   "---\n\nJust a rule at the top.\n",
+			want: "---\n\nJust a rule at the top.\n",
+		},
+		{
+			name: "should not treat a longer rule as a fence",
+			md:   "----\ntitle: nope\n----\nbody\n",
+			want: "----\ntitle: nope\n----\nbody\n",
+		},
+		{
+			name: "should not treat a setext heading on the second line as a fence",
+			md:   "Heading\n---\nbody\n",
+			want: "Heading\n---\nbody\n",
+		},
+		{
+			name: "should strip toml front matter",
+			md:   "+++\ntitle = \"toml\"\n+++\n" + testBodyWithRules,
+			want: testBodyWithRules,
+		},
+		{
+			name: "should handle crlf line endings",
+			md:   "---\r\ntitle: crlf\r\n---\r\nline one\r\n\r\n---\r\nline two\r\n",
+			want: "line one\r\n\r\n---\r\nline two\r\n",
+		},
+		{
+			name: "should handle a byte order mark before the fence",
+			md:   "\xef\xbb\xbf---\ntitle: bom\n---\nbody\n",
+			want: "body\n",
+		},
+		{
+			name: "should handle a closing fence at end of file",
+			md:   "---\ntitle: only metadata\n---",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RemoveMetaData(context.Background(), strings.NewReader(tt.md))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestGetTags(t *testing.T) {
+	t.Run("should only read tags from the leading front matter", func(t *testing.T) {
+		md := "---\ntags:\n  - go\n---\nbody\n\n---\ntags:\n  - not-a-tag\n---\n"
+		tags, err := GetTags(context.Background(), strings.NewReader(md))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"go"}, tags)
+	})
+}
+
+func TestConvertMDToHTML_KeepsRules(t *testing.T) {
+	t.Run("should render rules and tables after front matter", func(t *testing.T) {
+		body, err := RemoveMetaData(context.Background(), strings.NewReader("---\ntitle: rules\n---\n"+testBodyWithRules))
+		require.NoError(t, err)
+
+		html, err := HandleHTML{}.ConvertMDToHTML(context.Background(), strings.NewReader(string(body)))
+		require.NoError(t, err)
+		assert.Contains(t, string(html), "<hr>")
+		assert.Contains(t, string(html), "<h2")
+		assert.Contains(t, string(html), "<table>")
+		assert.Contains(t, string(html), "Second paragraph.")
+	})
+}
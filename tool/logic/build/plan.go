@@ -0,0 +1,179 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+const (
+	ActionAdd       = "add"
+	ActionChange    = "change"
+	ActionUnchanged = "unchanged"
+	ActionDelete    = "delete"
+
+	PlanFormatText = "text"
+	PlanFormatJSON = "json"
+)
+
+var ErrUnknownPlanFormat = errors.New("unknown plan format")
+
+type (
+	// DeployPlan is what a deploy would do to the target, one entry per key.
+	DeployPlan struct {
+		Entries []PlanEntry `json:"entries"`
+		Summary PlanSummary `json:"summary"`
+
+		files  map[string]OutputFile
+		hashes map[string]string
+	}
+
+	// PlanEntry is a single key of the plan. Size is the size of the file as uploaded, zero for deletes.
+	PlanEntry struct {
+		Key             string `json:"key"`
+		Action          string `json:"action"`
+		Size            int64  `json:"size"`
+		ContentType     string `json:"content_type,omitempty"`
+		ContentEncoding string `json:"content_encoding,omitempty"`
+	}
+
+	// PlanSummary counts the entries and bytes of each action.
+	PlanSummary struct {
+		Add       int   `json:"add"`
+		Change    int   `json:"change"`
+		Unchanged int   `json:"unchanged"`
+		Delete    int   `json:"delete"`
+		Bytes     int64 `json:"bytes"`
+	}
+)
+
+// Uploads returns the files to add or change.
+func (p DeployPlan) Uploads() []OutputFile {
+	uploads := make([]OutputFile, 0)
+	for _, entry := range p.Entries {
+		if entry.Action == ActionAdd || entry.Action == ActionChange {
+			uploads = append(uploads, p.files[entry.Key])
+		}
+	}
+	return uploads
+}
+
+// Hashes returns the md5 of every built file by key.
+func (p DeployPlan) Hashes() map[string]string {
+	return p.hashes
+}
+
+// Deletes returns the keys to prune.
+func (p DeployPlan) Deletes() []string {
+	keys := make([]string, 0)
+	for _, entry := range p.Entries {
+		if entry.Action == ActionDelete {
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys
+}
+
+// Plan compares outputFiles with dest without changing either. Files are compared as they were
+// built, so compressed files by their compressed bytes. When pruning would exceed the threshold the
+// full plan is returned along with an ErrPruneThreshold error.
+func (p Publisher) Plan(ctx context.Context, dest target.Target, outputFiles []OutputFile) (DeployPlan, error) {
+	rHashes, err := dest.GetHashes(ctx)
+	if err != nil {
+		slog.Error("error calculating hash from target", "error", err)
+		return DeployPlan{}, err
+	}
+	slog.Info("remote hashes", "hashes", rHashes)
+
+	plan := DeployPlan{
+		Entries: make([]PlanEntry, 0, len(outputFiles)),
+		files:   make(map[string]OutputFile, len(outputFiles)),
+		hashes:  make(map[string]string, len(outputFiles)),
+	}
+	for _, outputFile := range outputFiles {
+		hash, err := calcMD5(bytes.NewReader(outputFile.Body))
+		if err != nil {
+			slog.Error("error calculating hash", "key", outputFile.Key, "error", err)
+			return DeployPlan{}, err
+		}
+		plan.hashes[outputFile.Key] = hash
+		plan.files[outputFile.Key] = outputFile
+
+		entry := PlanEntry{
+			Key:             outputFile.Key,
+			Action:          ActionUnchanged,
+			Size:            int64(len(outputFile.Body)),
+			ContentType:     outputFile.ContentType,
+			ContentEncoding: outputFile.ContentEncoding,
+		}
+		if p.deploy.Force || shouldUpload(rHashes, outputFile.Key, hash) {
+			entry.Action = ActionChange
+			if _, ok := rHashes[outputFile.Key]; !ok {
+				entry.Action = ActionAdd
+			}
+		}
+		plan.add(entry)
+	}
+
+	if !p.deploy.Prune {
+		return plan, nil
+	}
+	orphans := orphanedKeys(rHashes, plan.hashes, p.deploy.Protected)
+	for _, key := range orphans {
+		plan.add(PlanEntry{Key: key, Action: ActionDelete})
+	}
+	return plan, checkPruneThreshold(len(orphans), len(rHashes), p.deploy)
+}
+
+func (p *DeployPlan) add(entry PlanEntry) {
+	p.Entries = append(p.Entries, entry)
+	switch entry.Action {
+	case ActionAdd:
+		p.Summary.Add++
+		p.Summary.Bytes += entry.Size
+	case ActionChange:
+		p.Summary.Change++
+		p.Summary.Bytes += entry.Size
+	case ActionUnchanged:
+		p.Summary.Unchanged++
+	case ActionDelete:
+		p.Summary.Delete++
+	}
+}
+
+// WritePlan prints the plan to w as a table of actions, sizes and keys, or as JSON.
+func WritePlan(w io.Writer, plan DeployPlan, format string) error {
+	switch format {
+	case PlanFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case PlanFormatText, "":
+	default:
+		return fmt.Errorf("%s: %w", format, ErrUnknownPlanFormat)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, entry := range plan.Entries {
+		size := "-"
+		if entry.Action != ActionDelete {
+			size = strconv.FormatInt(entry.Size, 10)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Action, size, entry.Key)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d to add, %d to change, %d unchanged, %d to delete, %d bytes to upload\n",
+		plan.Summary.Add, plan.Summary.Change, plan.Summary.Unchanged, plan.Summary.Delete, plan.Summary.Bytes)
+	return err
+}
@@ -0,0 +1,92 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_Plan(t *testing.T) {
+	t.Run("should sort every key into add, change, unchanged and delete without touching the bucket", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{}}
+		publisher, files := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 1}), renderTestSite(t)
+
+		first, err := publisher.Plan(context.Background(), dest, files)
+		require.NoError(t, err)
+		robotsHash, err := calcMD5(bytes.NewReader(first.files[RobotsKey].Body))
+		require.NoError(t, err)
+
+		dest.hashes = map[string]string{RobotsKey: robotsHash, "post.html": "stale", "gone.html": "x"}
+		plan, err := publisher.Plan(context.Background(), dest, files)
+		require.NoError(t, err)
+
+		actions := make(map[string]string, len(plan.Entries))
+		for _, entry := range plan.Entries {
+			actions[entry.Key] = entry.Action
+		}
+		assert.Equal(t, ActionUnchanged, actions[RobotsKey])
+		assert.Equal(t, ActionChange, actions["post.html"])
+		assert.Equal(t, ActionAdd, actions[IndexKey])
+		assert.Equal(t, ActionDelete, actions["gone.html"])
+		assert.Equal(t, 1, plan.Summary.Unchanged)
+		assert.Equal(t, 1, plan.Summary.Change)
+		assert.Equal(t, 1, plan.Summary.Delete)
+		assert.Equal(t, len(plan.Entries)-3, plan.Summary.Add)
+		assert.Equal(t, []string{"gone.html"}, plan.Deletes())
+		assert.Len(t, plan.Uploads(), plan.Summary.Add+plan.Summary.Change)
+		assert.Empty(t, dest.written)
+		assert.Empty(t, dest.deleted)
+	})
+
+	t.Run("should return the plan along with the threshold error", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{"a.html": "x"}}
+		publisher, files := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 0.5}), renderTestSite(t)
+
+		plan, err := publisher.Plan(context.Background(), dest, files)
+		assert.ErrorIs(t, err, ErrPruneThreshold)
+		assert.Equal(t, []string{"a.html"}, plan.Deletes())
+	})
+
+	t.Run("should fail when the target cannot be hashed", func(t *testing.T) {
+		errList := errors.New("access denied")
+		dest := &fakeTarget{hashErr: errList}
+
+		_, err := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 1}).Plan(context.Background(), dest, renderTestSite(t))
+		assert.ErrorIs(t, err, errList)
+	})
+}
+
+func TestWritePlan(t *testing.T) {
+	plan := DeployPlan{}
+	plan.add(PlanEntry{Key: "index.html", Action: ActionAdd, Size: 120})
+	plan.add(PlanEntry{Key: "post.html", Action: ActionUnchanged, Size: 80})
+	plan.add(PlanEntry{Key: "old.html", Action: ActionDelete})
+
+	t.Run("should print a table and summary as text", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WritePlan(&out, plan, PlanFormatText))
+		assert.Equal(t, "add        120  index.html\n"+
+			"unchanged  80   post.html\n"+
+			"delete     -    old.html\n"+
+			"\n1 to add, 0 to change, 1 unchanged, 1 to delete, 120 bytes to upload\n", out.String())
+	})
+
+	t.Run("should print json", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WritePlan(&out, plan, PlanFormatJSON))
+		var decoded DeployPlan
+		require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(t, plan.Entries, decoded.Entries)
+		assert.Equal(t, plan.Summary, decoded.Summary)
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		assert.ErrorIs(t, WritePlan(&bytes.Buffer{}, plan, "yaml"), ErrUnknownPlanFormat)
+	})
+}
@@ -0,0 +1,62 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/history"
+	"github.com/rmarken5/blog-builder/tool/logic/release"
+)
+
+var ErrPruneThreshold = errors.New("prune threshold exceeded")
+
+// reservedPrefixes hold what the tool keeps on the target next to the site, which is never pruned.
+var reservedPrefixes = []string{history.Prefix, release.Prefix}
+
+// orphanedKeys returns the remote keys that have no local counterpart and are not protected, sorted.
+func orphanedKeys(remoteHashes, localHashes map[string]string, protected []string) []string {
+	orphans := make([]string, 0)
+	for key := range remoteHashes {
+		if _, ok := localHashes[key]; ok {
+			continue
+		}
+		if isProtected(key, protected) || isProtected(key, reservedPrefixes) {
+			continue
+		}
+		orphans = append(orphans, key)
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// isProtected reports whether key matches one of the patterns. Patterns use path.Match syntax
+// against the whole key, and a pattern ending in a slash protects everything below that prefix.
+func isProtected(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(key, pattern) {
+				return true
+			}
+			continue
+		}
+		if ok, err := path.Match(pattern, key); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPruneThreshold fails when pruning orphans would remove more than the allowed share of the remote objects.
+func checkPruneThreshold(orphans int, remote int, deploy config.Deploy) error {
+	if orphans == 0 || remote == 0 {
+		return nil
+	}
+	if ratio := float64(orphans) / float64(remote); ratio > deploy.MaxPruneRatio {
+		return fmt.Errorf("pruning %d of %d objects (%.0f%%) exceeds max_prune_ratio %.2f: %w", orphans, remote, ratio*100, deploy.MaxPruneRatio, ErrPruneThreshold)
+	}
+	return nil
+}
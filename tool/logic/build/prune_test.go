@@ -0,0 +1,58 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanedKeys(t *testing.T) {
+	t.Run("should return sorted remote keys that are not built or protected", func(t *testing.T) {
+		remote := map[string]string{
+			"index.html":          "a",
+			"old-post.html":       "b",
+			"css/old.css":         "c",
+			"google123.html":      "d",
+			"uploads/2020/cv.pdf": "e",
+		}
+		local := map[string]string{"index.html": "a"}
+
+		orphans := orphanedKeys(remote, local, []string{"google*.html", "uploads/"})
+
+		assert.Equal(t, []string{"css/old.css", "old-post.html"}, orphans)
+	})
+}
+
+func TestIsProtected(t *testing.T) {
+	tests := []struct {
+		key      string
+		patterns []string
+		want     bool
+	}{
+		{key: "favicon.ico", patterns: []string{"favicon.ico"}, want: true},
+		{key: "img/a.png", patterns: []string{"img/*.png"}, want: true},
+		{key: "img/nested/a.png", patterns: []string{"img/*.png"}, want: false},
+		{key: "img/nested/a.png", patterns: []string{"img/"}, want: true},
+		{key: "a.html", patterns: []string{"[bad"}, want: false},
+		{key: "a.html", patterns: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, isProtected(tt.key, tt.patterns))
+		})
+	}
+}
+
+func TestCheckPruneThreshold(t *testing.T) {
+	deploy := config.Deploy{Prune: true, MaxPruneRatio: 0.25}
+
+	t.Run("should allow pruning up to the ratio", func(t *testing.T) {
+		assert.NoError(t, checkPruneThreshold(1, 4, deploy))
+		assert.NoError(t, checkPruneThreshold(0, 0, deploy))
+	})
+	t.Run("should abort when pruning more than the ratio", func(t *testing.T) {
+		err := checkPruneThreshold(2, 4, deploy)
+		assert.ErrorIs(t, err, ErrPruneThreshold)
+	})
+}
@@ -0,0 +1,73 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+var ErrPruneFailed = errors.New("prune failed")
+
+type (
+	// Publisher brings a target in line with a set of built files, whether they were just rendered
+	// or loaded from an artifact.
+	Publisher struct {
+		deploy config.Deploy
+	}
+
+	// DeployResult is what a successful deploy left on the target: the md5 of every built file by
+	// key, and the keys it uploaded and pruned.
+	DeployResult struct {
+		Hashes   map[string]string
+		Uploaded []string
+		Deleted  []string
+	}
+)
+
+func NewPublisher(deploy config.Deploy) *Publisher {
+	return &Publisher{
+		deploy: deploy,
+	}
+}
+
+// Deploy publishes the files that differ from what dest already holds, then prunes when enabled.
+func (p Publisher) Deploy(ctx context.Context, dest target.Target, outputFiles []OutputFile) (DeployResult, error) {
+	// the plan fails before anything is uploaded when pruning exceeds the threshold, leaving the target untouched
+	plan, err := p.Plan(ctx, dest, outputFiles)
+	if err != nil {
+		slog.Error("aborting deploy", "error", err)
+		return DeployResult{}, err
+	}
+
+	result := p.uploadFiles(ctx, dest, plan.Uploads(), p.deploy.Concurrency)
+	log.Printf("files written to target: %v", result.Uploaded)
+	for _, failure := range result.Failed {
+		log.Printf("failed to write %s to target: %v", failure.Key, failure.Err)
+	}
+	log.Printf("upload summary: %d uploaded, %d failed, %d unchanged", len(result.Uploaded), len(result.Failed), plan.Summary.Unchanged)
+	if err := result.Err(); err != nil {
+		// pruning after a partial upload could remove files the live pages still link to
+		return DeployResult{}, err
+	}
+
+	deployResult := DeployResult{
+		Hashes:   plan.Hashes(),
+		Uploaded: result.Uploaded,
+		Deleted:  plan.Deletes(),
+	}
+	if len(deployResult.Deleted) > 0 {
+		err = dest.DeleteFiles(ctx, deployResult.Deleted)
+		if err != nil {
+			slog.Error("error pruning target", "error", err)
+			return DeployResult{}, fmt.Errorf("error pruning %d files: %w - %w", len(deployResult.Deleted), err, ErrPruneFailed)
+		}
+		log.Printf("files pruned from target: %v", deployResult.Deleted)
+	}
+
+	return deployResult, nil
+}
@@ -0,0 +1,91 @@
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_Deploy(t *testing.T) {
+	t.Run("should leave orphaned objects alone unless pruning", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{"gone.html": "x"}}
+		publisher, files := NewPublisher(config.Deploy{MaxPruneRatio: 1}), renderTestSite(t)
+
+		_, err := publisher.Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		assert.Contains(t, dest.written, "post.html")
+		assert.Empty(t, dest.deleted)
+	})
+
+	t.Run("should delete orphaned objects except protected ones", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{"gone.html": "x", "keep/me.txt": "y", ".deploys/1.json": "z", "releases/a/index.html": "z"}}
+		publisher, files := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 1, Protected: []string{"keep/"}}), renderTestSite(t)
+
+		result, err := publisher.Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"gone.html"}, dest.deleted)
+		assert.Equal(t, []string{"gone.html"}, result.Deleted)
+		assert.ElementsMatch(t, dest.written, result.Uploaded)
+		assert.Len(t, result.Hashes, len(files))
+	})
+
+	t.Run("should abort before uploading when too much would be pruned", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{"a.html": "x", "b.html": "y"}}
+		publisher, files := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 0.5}), renderTestSite(t)
+
+		_, err := publisher.Deploy(context.Background(), dest, files)
+		assert.ErrorIs(t, err, ErrPruneThreshold)
+		assert.Empty(t, dest.written)
+		assert.Empty(t, dest.deleted)
+	})
+
+	t.Run("should not prune when an upload failed", func(t *testing.T) {
+		dest := &fakeTarget{hashes: map[string]string{"gone.html": "x"}, fail: map[string]error{"post.html": ErrUploadsFailed}}
+		publisher, files := NewPublisher(config.Deploy{Prune: true, MaxPruneRatio: 1, Concurrency: 4}), renderTestSite(t)
+
+		_, err := publisher.Deploy(context.Background(), dest, files)
+		assert.ErrorIs(t, err, ErrUploadsFailed)
+		assert.Contains(t, dest.written, IndexKey)
+		assert.Empty(t, dest.deleted)
+	})
+
+	t.Run("should publish to an in memory target and upload nothing the second time", func(t *testing.T) {
+		dest := target.NewMemory()
+		publisher, files := NewPublisher(config.Deploy{MaxPruneRatio: 1}), renderTestSite(t)
+
+		_, err := publisher.Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		post, ok := dest.Get("post.html")
+		require.True(t, ok)
+		assert.Equal(t, contentTypeHTML, post.ContentType)
+
+		plan, err := publisher.Plan(context.Background(), dest, files)
+		require.NoError(t, err)
+		assert.Empty(t, plan.Uploads())
+		assert.Equal(t, len(dest.Keys()), plan.Summary.Unchanged)
+	})
+
+	t.Run("should upload with the matching rules and reupload everything when forced", func(t *testing.T) {
+		dest := target.NewMemory()
+		deploy := config.Deploy{MaxPruneRatio: 1, Rules: []config.ObjectRule{{Match: "*.html", CacheControl: "max-age=300"}}}
+		files := renderTestSite(t)
+
+		_, err := NewPublisher(deploy).Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		post, ok := dest.Get("post.html")
+		require.True(t, ok)
+		assert.Equal(t, "max-age=300", post.CacheControl)
+		robots, ok := dest.Get(RobotsKey)
+		require.True(t, ok)
+		assert.Empty(t, robots.CacheControl)
+
+		deploy.Force = true
+		result, err := NewPublisher(deploy).Deploy(context.Background(), dest, files)
+		require.NoError(t, err)
+		assert.Len(t, result.Uploaded, len(files))
+	})
+}
@@ -0,0 +1,209 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRedirectsPath is the redirects file read when no other is given.
+const DefaultRedirectsPath = "redirects.yaml"
+
+var ErrInvalidRedirect = errors.New("invalid redirect")
+
+var _ RedirectHandler = HandleRedirect{}
+
+// redirectPage is the fallback for targets that cannot redirect by themselves. It sends browsers
+// on straight away and tells search engines where the page lives now.
+var redirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Redirecting to {{.}}</title>
+<link rel="canonical" href="{{.}}">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url={{.}}">
+</head>
+<body>
+<p>This page has moved to <a href="{{.}}">{{.}}</a>.</p>
+</body>
+</html>
+`))
+
+type (
+	RedirectHandler interface {
+		BuildRedirects(ctx context.Context, pages []Page, outputFiles []OutputFile) ([]OutputFile, error)
+	}
+
+	HandleRedirect struct {
+		site          config.Site
+		redirectsFile string
+	}
+
+	// Redirect sends requests for the path From to To, a path of the site or an absolute url.
+	Redirect struct {
+		From string `yaml:"from"`
+		To   string `yaml:"to"`
+	}
+)
+
+func NewHandleRedirect(site config.Site, redirectsFile string) *HandleRedirect {
+	return &HandleRedirect{
+		site:          site,
+		redirectsFile: redirectsFile,
+	}
+}
+
+// BuildRedirects returns a file for every old path of the site, from the aliases in the front
+// matter of pages and from the redirects file. Each file has its RedirectLocation set and a body
+// with a meta refresh to it, so targets that cannot redirect serve that page instead. An old path
+// may not be a file of the site, since the redirect would replace it.
+func (r HandleRedirect) BuildRedirects(ctx context.Context, pages []Page, outputFiles []OutputFile) ([]OutputFile, error) {
+	redirects, err := LoadRedirects(r.redirectsFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		for _, alias := range page.Aliases {
+			redirects = append(redirects, Redirect{From: alias, To: page.Key})
+		}
+	}
+
+	existing := make(map[string]bool, len(outputFiles))
+	for _, outputFile := range outputFiles {
+		existing[outputFile.Key] = true
+	}
+	locations := make(map[string]string, len(redirects))
+	for _, redirect := range redirects {
+		from, err := redirectKey(redirect.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := redirectLocation(redirect.To)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case existing[from]:
+			return nil, fmt.Errorf("%s is a file of the site and cannot redirect to %s: %w", from, redirect.To, ErrInvalidRedirect)
+		case locations[from] != "" && locations[from] != to:
+			return nil, fmt.Errorf("%s redirects to both %s and %s: %w", from, locations[from], to, ErrInvalidRedirect)
+		case to == strings.TrimSuffix(from, IndexKey):
+			return nil, fmt.Errorf("%s redirects to itself: %w", from, ErrInvalidRedirect)
+		}
+		locations[from] = to
+	}
+
+	redirectFiles := make([]OutputFile, 0, len(locations))
+	for from, to := range locations {
+		body, err := r.redirectPage(from, to)
+		if err != nil {
+			slog.Error("error rendering redirect page", "key", from, "error", err)
+			return nil, err
+		}
+		redirectFiles = append(redirectFiles, OutputFile{
+			Key:              from,
+			ContentType:      contentTypeHTML,
+			Body:             body,
+			RedirectLocation: to,
+		})
+	}
+	sort.Slice(redirectFiles, func(i, j int) bool { return redirectFiles[i].Key < redirectFiles[j].Key })
+	return redirectFiles, nil
+}
+
+// redirectPage renders the meta refresh page stored at key. It links to the absolute url of to
+// when the site has a base url, and relative to key otherwise.
+func (r HandleRedirect) redirectPage(key, to string) ([]byte, error) {
+	link := to
+	if !isAbsoluteURL(to) {
+		if r.site.BaseURL != "" {
+			link = absoluteURL(r.site.BaseURL, to)
+		} else if link = strings.Repeat("../", strings.Count(key, "/")) + to; link == "" {
+			link = "./"
+		}
+	}
+	var buf bytes.Buffer
+	if err := redirectPage.Execute(&buf, link); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadRedirects reads a yaml list of redirects from file. A missing file holds none.
+func LoadRedirects(file string) ([]Redirect, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Redirect{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	redirects := make([]Redirect, 0)
+	if err := yaml.Unmarshal(b, &redirects); err != nil {
+		return nil, fmt.Errorf("error decoding redirects file %s: %w - %w", file, err, ErrInvalidRedirect)
+	}
+	return redirects, nil
+}
+
+// redirectKey returns the key of the old path p, a directory such as /2019/post/ ending up as
+// its index.html.
+func redirectKey(p string) (string, error) {
+	key, err := sitePath(p)
+	if err != nil {
+		return "", err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += IndexKey
+	}
+	return key, nil
+}
+
+// redirectLocation returns where a redirect to p points: an absolute url as it is, or a path
+// relative to the root of the site, with directories rather than their index.html.
+func redirectLocation(p string) (string, error) {
+	if isAbsoluteURL(p) {
+		return p, nil
+	}
+	location, err := sitePath(p)
+	if err != nil {
+		return "", err
+	}
+	if location == IndexKey || strings.HasSuffix(location, "/"+IndexKey) {
+		location = strings.TrimSuffix(location, IndexKey)
+	}
+	return location, nil
+}
+
+// sitePath cleans p into a slash separated path below the root of the site, keeping a trailing slash.
+func sitePath(p string) (string, error) {
+	trimmed := strings.TrimSpace(p)
+	if trimmed == "" {
+		return "", fmt.Errorf("empty path: %w", ErrInvalidRedirect)
+	}
+	if slices.Contains(strings.Split(trimmed, "/"), "..") {
+		return "", fmt.Errorf("path %s leaves the site: %w", p, ErrInvalidRedirect)
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+trimmed), "/")
+	if cleaned != "" && strings.HasSuffix(trimmed, "/") {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
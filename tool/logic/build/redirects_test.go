@@ -0,0 +1,65 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRedirect_BuildRedirects(t *testing.T) {
+	ctx := context.Background()
+	pages := []Page{
+		{Key: "posts/go/hello.html", FrontMatter: FrontMatter{Aliases: []string{"/hello.html", "/2024/hello/"}}},
+		{Key: "about/index.html", FrontMatter: FrontMatter{Aliases: []string{"about.html"}}},
+	}
+	site := []OutputFile{{Key: "posts/go/hello.html"}, {Key: "about/index.html"}, {Key: IndexKey}}
+
+	t.Run("should redirect aliases and the redirects file to the new paths", func(t *testing.T) {
+		redirectsFile := filepath.Join(t.TempDir(), DefaultRedirectsPath)
+		require.NoError(t, os.WriteFile(redirectsFile, []byte("- from: /old-feed.xml\n  to: https://feeds.example.com/blog\n"), 0666))
+
+		files, err := NewHandleRedirect(config.Site{BaseURL: "https://example.com/"}, redirectsFile).BuildRedirects(ctx, pages, site)
+		require.NoError(t, err)
+
+		locations := make(map[string]string)
+		for _, file := range files {
+			locations[file.Key] = file.RedirectLocation
+			assert.Equal(t, contentTypeHTML, file.ContentType)
+		}
+		assert.Equal(t, map[string]string{
+			"hello.html":            "posts/go/hello.html",
+			"2024/hello/index.html": "posts/go/hello.html",
+			"about.html":            "about/",
+			"old-feed.xml":          "https://feeds.example.com/blog",
+		}, locations)
+		assert.Equal(t, "2024/hello/index.html", files[0].Key)
+		assert.Contains(t, string(files[0].Body), `<link rel="canonical" href="https://example.com/posts/go/hello.html">`)
+		assert.Contains(t, string(files[0].Body), `<meta http-equiv="refresh" content="0; url=https://example.com/posts/go/hello.html">`)
+	})
+
+	t.Run("should link relative to the old path without a base url", func(t *testing.T) {
+		files, err := NewHandleRedirect(config.Site{}, filepath.Join(t.TempDir(), DefaultRedirectsPath)).BuildRedirects(ctx, pages[:1], site)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		assert.Contains(t, string(files[0].Body), `href="../../posts/go/hello.html"`)
+		assert.Contains(t, string(files[1].Body), `href="posts/go/hello.html"`)
+	})
+
+	t.Run("should reject redirects that would replace a file, conflict or leave the site", func(t *testing.T) {
+		handler := NewHandleRedirect(config.Site{}, filepath.Join(t.TempDir(), DefaultRedirectsPath))
+		for _, aliases := range [][]string{{"/"}, {"../hello.html"}} {
+			_, err := handler.BuildRedirects(ctx, []Page{{Key: "posts/hello.html", FrontMatter: FrontMatter{Aliases: aliases}}}, site)
+			assert.ErrorIs(t, err, ErrInvalidRedirect, aliases)
+		}
+		_, err := handler.BuildRedirects(ctx, []Page{
+			{Key: "a.html", FrontMatter: FrontMatter{Aliases: []string{"old.html"}}},
+			{Key: "b.html", FrontMatter: FrontMatter{Aliases: []string{"/old.html"}}},
+		}, site)
+		assert.ErrorIs(t, err, ErrInvalidRedirect)
+	})
+}
@@ -0,0 +1,55 @@
+package build
+
+import (
+	"path"
+	"strings"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+// objectOptions returns what outputFile is uploaded with: its content type and redirect location
+// and whatever the matching rules add, later rules overriding earlier ones. The encoding of a
+// compressed file always wins over a rule, since the body cannot be read without it.
+func objectOptions(outputFile OutputFile, rules []config.ObjectRule) target.ObjectOptions {
+	opts := target.ObjectOptions{ContentType: outputFile.ContentType, WebsiteRedirectLocation: outputFile.RedirectLocation}
+	for _, rule := range rules {
+		if !matchRule(rule.Match, outputFile.Key) {
+			continue
+		}
+		opts.CacheControl = override(opts.CacheControl, rule.CacheControl)
+		opts.ContentDisposition = override(opts.ContentDisposition, rule.ContentDisposition)
+		opts.ContentEncoding = override(opts.ContentEncoding, rule.ContentEncoding)
+		opts.StorageClass = override(opts.StorageClass, rule.StorageClass)
+		for name, value := range rule.Metadata {
+			if opts.Metadata == nil {
+				opts.Metadata = make(map[string]string)
+			}
+			opts.Metadata[name] = value
+		}
+	}
+	opts.ContentEncoding = override(opts.ContentEncoding, outputFile.ContentEncoding)
+	return opts
+}
+
+// matchRule reports whether key matches pattern. A pattern ending in a slash matches everything
+// below that prefix, a pattern without a slash matches the file name in any directory and any
+// other pattern is matched against the whole key.
+func matchRule(pattern, key string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(key, pattern)
+	}
+	name := key
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(key)
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+func override(current, value string) string {
+	if value == "" {
+		return current
+	}
+	return value
+}
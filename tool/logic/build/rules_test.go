@@ -0,0 +1,66 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		key     string
+		want    bool
+	}{
+		{name: "should match a file name in any directory", pattern: "*.html", key: "posts/hello.html", want: true},
+		{name: "should match a pattern with a slash against the whole key", pattern: "css/*.css", key: "css/main.css", want: true},
+		{name: "should not match a pattern with a slash in another directory", pattern: "css/*.css", key: "themes/css/main.css"},
+		{name: "should match everything below a prefix", pattern: "downloads/", key: "downloads/2026/book.pdf", want: true},
+		{name: "should not match a different extension", pattern: "*.html", key: "feed.xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchRule(tt.pattern, tt.key))
+		})
+	}
+}
+
+func TestObjectOptions(t *testing.T) {
+	rules := []config.ObjectRule{
+		{Match: "*", CacheControl: "public, max-age=300", Metadata: map[string]string{"site": "blog"}},
+		{Match: "css/*.css", CacheControl: "public, max-age=31536000, immutable"},
+		{Match: "downloads/", ContentDisposition: "attachment", StorageClass: "STANDARD_IA", Metadata: map[string]string{"kind": "download"}},
+	}
+
+	t.Run("should let later rules override earlier ones", func(t *testing.T) {
+		opts := objectOptions(OutputFile{Key: "css/main.css", ContentType: "text/css"}, rules)
+		assert.Equal(t, target.ObjectOptions{
+			ContentType:  "text/css",
+			CacheControl: "public, max-age=31536000, immutable",
+			Metadata:     map[string]string{"site": "blog"},
+		}, opts)
+	})
+
+	t.Run("should merge the metadata of every matching rule", func(t *testing.T) {
+		opts := objectOptions(OutputFile{Key: "downloads/book.pdf", ContentType: "application/pdf"}, rules)
+		assert.Equal(t, target.ObjectOptions{
+			ContentType:        "application/pdf",
+			CacheControl:       "public, max-age=300",
+			ContentDisposition: "attachment",
+			StorageClass:       "STANDARD_IA",
+			Metadata:           map[string]string{"site": "blog", "kind": "download"},
+		}, opts)
+	})
+
+	t.Run("should keep the encoding of a compressed file over a rule", func(t *testing.T) {
+		opts := objectOptions(OutputFile{Key: "index.html", ContentEncoding: EncodingGzip}, []config.ObjectRule{{Match: "*", ContentEncoding: EncodingBrotli}})
+		assert.Equal(t, EncodingGzip, opts.ContentEncoding)
+	})
+
+	t.Run("should only set the content type without rules", func(t *testing.T) {
+		assert.Equal(t, target.ObjectOptions{ContentType: "text/html"}, objectOptions(OutputFile{Key: "index.html", ContentType: "text/html"}, nil))
+	})
+}
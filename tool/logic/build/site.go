@@ -0,0 +1,169 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	IndexLayout  = "index"
+	IndexKey     = "index.html"
+	excerptWords = 40
+)
+
+// Page is a parsed markdown file along with everything lists and feeds need to link to it.
+// Modified is the modification time of the markdown file.
+type Page struct {
+	FrontMatter
+	Key      string
+	Content  template.HTML
+	Excerpt  string
+	Modified time.Time
+}
+
+// LastMod is the updated date from front matter, then the created date, then the file modification time.
+func (p Page) LastMod() time.Time {
+	return postUpdated(p, p.Modified)
+}
+
+// IsPost reports whether the page belongs in the post listings.
+func (p Page) IsPost() bool {
+	return p.Key != IndexKey && (p.Layout == "" || p.Layout == DefaultLayout)
+}
+
+// loadPage parses a markdown file into a Page without rendering it through a layout.
+func (b BuildPayload) loadPage(ctx context.Context, mdFile ReaderWithPath, inputPath string) (Page, error) {
+	modified := time.Time{}
+	if f, ok := mdFile.Reader.(fs.File); ok {
+		if info, err := f.Stat(); err == nil {
+			modified = info.ModTime().UTC()
+		}
+	}
+
+	mdBytes := bytes.NewBuffer([]byte{})
+	_, err := io.Copy(mdBytes, mdFile.Reader)
+	if err != nil {
+		slog.Error("error copying bytes to buffer for mdfile", "error", err)
+	}
+	mdFile.Reader.Close()
+
+	frontMatter, mdStripped, err := ParseFrontMatter(ctx, bytes.NewReader(mdBytes.Bytes()))
+	if err != nil {
+		slog.Error("error parsing front matter from md", "path", mdFile.Path, "error", err)
+		return Page{}, fmt.Errorf("error parsing front matter of %s: %w", mdFile.Path, err)
+	}
+	if frontMatter.Title == "" {
+		frontMatter.Title = TitleFromMarkdown(mdStripped)
+	}
+	// a tag without a slug has no archive page to link to
+	frontMatter.Tags = slices.DeleteFunc(frontMatter.Tags, func(tag string) bool {
+		if Slugify(tag) == "" {
+			slog.Warn("skipping tag without letters or digits", "path", mdFile.Path, "tag", tag)
+			return true
+		}
+		return false
+	})
+
+	htmlBytes, err := b.htmlHandler.ConvertMDToHTML(ctx, bytes.NewReader(mdStripped))
+	if err != nil {
+		slog.Error("error converting md to html", "error", err)
+		return Page{}, err
+	}
+
+	htmlBytes, err = b.htmlHandler.ConvertMdLinksToHtml(bytes.NewReader(htmlBytes))
+	if err != nil {
+		slog.Error("error converting md links to html", "error", err)
+		return Page{}, err
+	}
+
+	excerpt := frontMatter.Description
+	if excerpt == "" {
+		excerpt = ExcerptFromMarkdown(mdStripped, excerptWords)
+	}
+
+	return Page{
+		FrontMatter: frontMatter,
+		Key:         strings.Replace(strings.TrimPrefix(filepath.ToSlash(mdFile.Path), filepath.ToSlash(inputPath)+"/"), markdownFileExtension, HTMLFileExtension, -1),
+		Content:     template.HTML(htmlBytes),
+		Excerpt:     excerpt,
+		Modified:    modified,
+	}, nil
+}
+
+// renderPage executes layout for the page stored at key, filling in the links that depend on its depth.
+func (b BuildPayload) renderPage(ctx context.Context, layout, key string, data PageData, stylesheets []string) ([]byte, error) {
+	data.Root = strings.Repeat("../", strings.Count(key, "/"))
+	data.Stylesheets = make([]string, 0, len(stylesheets))
+	for _, stylesheet := range stylesheets {
+		data.Stylesheets = append(data.Stylesheets, data.Root+stylesheet)
+	}
+
+	htmlBytes, err := b.layoutHandler.RenderPage(ctx, layout, data)
+	if err != nil {
+		slog.Error("error rendering layout", "key", key, "layout", layout, "error", err)
+		return nil, err
+	}
+	return htmlBytes, nil
+}
+
+// renderHome lists every post newest first on the generated index.html.
+func (b BuildPayload) renderHome(ctx context.Context, pages []Page, stylesheets []string) (OutputFile, error) {
+	posts := sortedPosts(pages)
+	htmlBytes, err := b.renderPage(ctx, IndexLayout, IndexKey, PageData{
+		Pages: posts,
+	}, stylesheets)
+	if err != nil {
+		return OutputFile{}, err
+	}
+	return OutputFile{
+		Key:         IndexKey,
+		ContentType: contentTypeHTML,
+		Body:        htmlBytes,
+		Modified:    latestLastMod(posts),
+	}, nil
+}
+
+// sortedPosts returns the posts in pages ordered by created date, newest first.
+// Posts without a created date are listed last, ordered by title.
+func sortedPosts(pages []Page) []Page {
+	posts := make([]Page, 0, len(pages))
+	for _, page := range pages {
+		if page.IsPost() {
+			posts = append(posts, page)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].Created.Equal(posts[j].Created) {
+			return posts[i].Created.After(posts[j].Created)
+		}
+		return posts[i].Title < posts[j].Title
+	})
+	return posts
+}
+
+func latestLastMod(pages []Page) time.Time {
+	lastMods := make([]time.Time, 0, len(pages))
+	for _, page := range pages {
+		lastMods = append(lastMods, page.LastMod())
+	}
+	return latest(lastMods)
+}
+
+func hasPage(pages []Page, key string) bool {
+	for _, page := range pages {
+		if page.Key == key {
+			return true
+		}
+	}
+	return false
+}
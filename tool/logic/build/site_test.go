@@ -0,0 +1,28 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortedPosts(t *testing.T) {
+	t.Run("should order posts newest first and skip non posts", func(t *testing.T) {
+		pages := []Page{
+			{Key: "old.html", FrontMatter: FrontMatter{Title: "Old", Created: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			{Key: "undated.html", FrontMatter: FrontMatter{Title: "Undated"}},
+			{Key: "new.html", FrontMatter: FrontMatter{Title: "New", Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			{Key: "about.html", FrontMatter: FrontMatter{Title: "About", Layout: ListLayout}},
+			{Key: IndexKey, FrontMatter: FrontMatter{Title: "Home"}},
+		}
+
+		posts := sortedPosts(pages)
+
+		keys := make([]string, 0, len(posts))
+		for _, post := range posts {
+			keys = append(keys, post.Key)
+		}
+		assert.Equal(t, []string{"new.html", "old.html", "undated.html"}, keys)
+	})
+}
@@ -0,0 +1,185 @@
+package build
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+const (
+	SitemapKey = "sitemap.xml"
+	RobotsKey  = "robots.txt"
+
+	contentTypeXML  = "application/xml"
+	contentTypeText = "text/plain"
+
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapLimit     = 50000
+	sitemapDate      = "2006-01-02"
+)
+
+var _ SitemapHandler = HandleSitemap{}
+
+type (
+	SitemapHandler interface {
+		BuildSitemap(ctx context.Context, outputFiles []OutputFile) ([]OutputFile, error)
+		BuildRobots(ctx context.Context) (OutputFile, error)
+	}
+
+	HandleSitemap struct {
+		site    config.Site
+		sitemap config.Sitemap
+		robots  config.Robots
+	}
+
+	sitemapURLSet struct {
+		XMLName   xml.Name     `xml:"urlset"`
+		Namespace string       `xml:"xmlns,attr"`
+		URLs      []sitemapURL `xml:"url"`
+	}
+	sitemapURL struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	}
+	sitemapIndex struct {
+		XMLName   xml.Name     `xml:"sitemapindex"`
+		Namespace string       `xml:"xmlns,attr"`
+		Sitemaps  []sitemapURL `xml:"sitemap"`
+	}
+)
+
+func NewHandleSitemap(site config.Site, sitemap config.Sitemap, robots config.Robots) *HandleSitemap {
+	return &HandleSitemap{
+		site:    site,
+		sitemap: sitemap,
+		robots:  robots,
+	}
+}
+
+// BuildSitemap lists every html file in outputFiles. Once there are more urls than fit in one
+// sitemap they are split over sitemap-1.xml, sitemap-2.xml, ... and sitemap.xml becomes their index.
+// A sitemap may only hold absolute urls, so without a base url there is none.
+func (s HandleSitemap) BuildSitemap(ctx context.Context, outputFiles []OutputFile) ([]OutputFile, error) {
+	if s.site.BaseURL == "" {
+		slog.Warn("site base_url is not set, skipping sitemap")
+		return []OutputFile{}, nil
+	}
+
+	urls := make([]sitemapURL, 0)
+	lastMods := make([]time.Time, 0)
+	for _, outputFile := range outputFiles {
+		if !isHTML(outputFile.ContentType) {
+			continue
+		}
+		urls = append(urls, sitemapURL{
+			Loc:     absoluteURL(s.site.BaseURL, outputFile.Key),
+			LastMod: formatLastMod(outputFile.Modified),
+		})
+		lastMods = append(lastMods, outputFile.Modified)
+	}
+
+	maxURLs := s.sitemap.MaxURLs
+	if maxURLs <= 0 || maxURLs > sitemapLimit {
+		maxURLs = sitemapLimit
+	}
+	if len(urls) <= maxURLs {
+		body, err := marshalXML(sitemapURLSet{Namespace: sitemapNamespace, URLs: urls})
+		if err != nil {
+			slog.Error("error building sitemap", "error", err)
+			return nil, err
+		}
+		return []OutputFile{{Key: SitemapKey, ContentType: contentTypeXML, Body: body}}, nil
+	}
+
+	sitemaps := make([]OutputFile, 0)
+	index := sitemapIndex{Namespace: sitemapNamespace}
+	for start := 0; start < len(urls); start += maxURLs {
+		end := min(start+maxURLs, len(urls))
+		key := fmt.Sprintf("sitemap-%d.xml", len(sitemaps)+1)
+		body, err := marshalXML(sitemapURLSet{Namespace: sitemapNamespace, URLs: urls[start:end]})
+		if err != nil {
+			slog.Error("error building sitemap", "key", key, "error", err)
+			return nil, err
+		}
+
+		lastMod := latest(lastMods[start:end])
+		sitemaps = append(sitemaps, OutputFile{Key: key, ContentType: contentTypeXML, Body: body, Modified: lastMod})
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{
+			Loc:     absoluteURL(s.site.BaseURL, key),
+			LastMod: formatLastMod(lastMod),
+		})
+	}
+
+	body, err := marshalXML(index)
+	if err != nil {
+		slog.Error("error building sitemap index", "error", err)
+		return nil, err
+	}
+	return append([]OutputFile{{Key: SitemapKey, ContentType: contentTypeXML, Body: body}}, sitemaps...), nil
+}
+
+// BuildRobots writes the configured rules followed by the location of the sitemap, when there is
+// a base url to build one.
+func (s HandleSitemap) BuildRobots(ctx context.Context) (OutputFile, error) {
+	var sb strings.Builder
+	for _, rule := range s.robots.Rules {
+		userAgent := rule.UserAgent
+		if userAgent == "" {
+			userAgent = "*"
+		}
+		fmt.Fprintf(&sb, "User-agent: %s\n", userAgent)
+		for _, allow := range rule.Allow {
+			fmt.Fprintf(&sb, "Allow: %s\n", allow)
+		}
+		for _, disallow := range rule.Disallow {
+			fmt.Fprintf(&sb, "Disallow: %s\n", disallow)
+		}
+		sb.WriteString("\n")
+	}
+	if s.site.BaseURL != "" {
+		fmt.Fprintf(&sb, "Sitemap: %s\n", absoluteURL(s.site.BaseURL, SitemapKey))
+	}
+
+	return OutputFile{Key: RobotsKey, ContentType: contentTypeText, Body: []byte(sb.String())}, nil
+}
+
+// isHTML reports whether contentType is html, with or without parameters such as a charset.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == contentTypeHTML
+}
+
+func formatLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(sitemapDate)
+}
+
+func latest(times []time.Time) time.Time {
+	l := time.Time{}
+	for _, t := range times {
+		if t.After(l) {
+			l = t
+		}
+	}
+	return l
+}
+
+// absoluteURL joins key onto baseURL, dropping a trailing index.html so directories get their pretty url.
+// Without a base url the key is returned as is.
+func absoluteURL(baseURL, key string) string {
+	if baseURL == "" {
+		return key
+	}
+	if key == IndexKey || strings.HasSuffix(key, "/"+IndexKey) {
+		key = strings.TrimSuffix(key, IndexKey)
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + key
+}
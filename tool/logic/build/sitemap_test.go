@@ -0,0 +1,90 @@
+package build
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSitemapFiles() []OutputFile {
+	return []OutputFile{
+		{Key: "css/theme.css", ContentType: contentTypeCSS},
+		{Key: IndexKey, ContentType: contentTypeHTML, Modified: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Key: "posts/a.html", ContentType: contentTypeHTML, Modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Key: "tags/go/index.html", ContentType: contentTypeHTML},
+		{Key: "about.html", ContentType: "text/html; charset=utf-8"},
+		{Key: RSSKey, ContentType: contentTypeRSS},
+	}
+}
+
+func TestHandleSitemap_BuildSitemap(t *testing.T) {
+	site := config.Site{BaseURL: "https://blog.example.com"}
+
+	t.Run("should list html files with lastmod", func(t *testing.T) {
+		files, err := NewHandleSitemap(site, config.Sitemap{}, config.Robots{}).BuildSitemap(context.Background(), testSitemapFiles())
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, SitemapKey, files[0].Key)
+		assert.Equal(t, "application/xml", files[0].ContentType)
+
+		var urlSet sitemapURLSet
+		require.NoError(t, xml.Unmarshal(files[0].Body, &urlSet))
+		assert.Equal(t, []sitemapURL{
+			{Loc: "https://blog.example.com/", LastMod: "2024-03-01"},
+			{Loc: "https://blog.example.com/posts/a.html", LastMod: "2024-01-01"},
+			{Loc: "https://blog.example.com/tags/go/"},
+			{Loc: "https://blog.example.com/about.html"},
+		}, urlSet.URLs)
+	})
+	t.Run("should skip the sitemap without a base url", func(t *testing.T) {
+		files, err := NewHandleSitemap(config.Site{}, config.Sitemap{}, config.Robots{}).BuildSitemap(context.Background(), testSitemapFiles())
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+	t.Run("should split into a sitemap index past the url limit", func(t *testing.T) {
+		files, err := NewHandleSitemap(site, config.Sitemap{MaxURLs: 2}, config.Robots{}).BuildSitemap(context.Background(), testSitemapFiles())
+		require.NoError(t, err)
+		require.Len(t, files, 3)
+		assert.Equal(t, SitemapKey, files[0].Key)
+		assert.Equal(t, "sitemap-1.xml", files[1].Key)
+		assert.Equal(t, "sitemap-2.xml", files[2].Key)
+
+		var index sitemapIndex
+		require.NoError(t, xml.Unmarshal(files[0].Body, &index))
+		assert.Equal(t, []sitemapURL{
+			{Loc: "https://blog.example.com/sitemap-1.xml", LastMod: "2024-03-01"},
+			{Loc: "https://blog.example.com/sitemap-2.xml"},
+		}, index.Sitemaps)
+
+		var urlSet sitemapURLSet
+		require.NoError(t, xml.Unmarshal(files[2].Body, &urlSet))
+		assert.Len(t, urlSet.URLs, 2)
+	})
+}
+
+func TestHandleSitemap_BuildRobots(t *testing.T) {
+	t.Run("should write rules and point at the sitemap", func(t *testing.T) {
+		robots := config.Robots{Rules: []config.RobotsRule{
+			{UserAgent: "*", Allow: []string{"/"}, Disallow: []string{"/drafts/"}},
+			{UserAgent: "BadBot", Disallow: []string{"/"}},
+		}}
+
+		file, err := NewHandleSitemap(config.Site{BaseURL: "https://blog.example.com/"}, config.Sitemap{}, robots).BuildRobots(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, RobotsKey, file.Key)
+		assert.Equal(t, "text/plain", file.ContentType)
+		assert.Equal(t, "User-agent: *\nAllow: /\nDisallow: /drafts/\n\nUser-agent: BadBot\nDisallow: /\n\nSitemap: https://blog.example.com/sitemap.xml\n", string(file.Body))
+	})
+	t.Run("should leave out the sitemap without a base url", func(t *testing.T) {
+		robots := config.Robots{Rules: []config.RobotsRule{{Disallow: []string{"/drafts/"}}}}
+
+		file, err := NewHandleSitemap(config.Site{}, config.Sitemap{}, robots).BuildRobots(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "User-agent: *\nDisallow: /drafts/\n\n", string(file.Body))
+	})
+}
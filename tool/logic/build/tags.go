@@ -0,0 +1,119 @@
+package build
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	TagLayout      = "tag"
+	TagIndexLayout = "tag-index"
+	tagsDir        = "tags"
+)
+
+// Tag is one tag with every post that carries it, newest first.
+type Tag struct {
+	Name  string
+	Slug  string
+	Pages []Page
+}
+
+// Key is where the archive page for the tag is written.
+func (t Tag) Key() string {
+	return TagKey(t.Slug)
+}
+
+// TagKey returns the key of the archive page for the tag with slug.
+func TagKey(slug string) string {
+	return tagsDir + "/" + slug + "/" + IndexKey
+}
+
+// Slugify lowercases s and replaces every run of characters that are not letters or digits with a dash.
+func Slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return sb.String()
+}
+
+// collectTags groups the posts by tag. Tags that only differ in case or punctuation share a slug
+// and are merged under the first spelling seen. Tags are ordered by name.
+func collectTags(pages []Page) []Tag {
+	bySlug := make(map[string]*Tag)
+	order := make([]string, 0)
+	for _, page := range sortedPosts(pages) {
+		for _, name := range page.Tags {
+			slug := Slugify(name)
+			if slug == "" {
+				continue
+			}
+			tag, ok := bySlug[slug]
+			if !ok {
+				tag = &Tag{Name: name, Slug: slug}
+				bySlug[slug] = tag
+				order = append(order, slug)
+			}
+			if len(tag.Pages) == 0 || tag.Pages[len(tag.Pages)-1].Key != page.Key {
+				tag.Pages = append(tag.Pages, page)
+			}
+		}
+	}
+
+	tags := make([]Tag, 0, len(order))
+	for _, slug := range order {
+		tags = append(tags, *bySlug[slug])
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name)
+	})
+	return tags
+}
+
+// renderTags writes an archive page for every tag and the tag index listing them all.
+func (b BuildPayload) renderTags(ctx context.Context, pages []Page, stylesheets []string) ([]OutputFile, error) {
+	tags := collectTags(pages)
+	outputFiles := make([]OutputFile, 0, len(tags)+1)
+	for _, tag := range tags {
+		htmlBytes, err := b.renderPage(ctx, TagLayout, tag.Key(), PageData{
+			Page:  Page{FrontMatter: FrontMatter{Title: tag.Name}},
+			Pages: tag.Pages,
+			Tags:  []Tag{tag},
+		}, stylesheets)
+		if err != nil {
+			return nil, err
+		}
+		outputFiles = append(outputFiles, OutputFile{
+			Key:         tag.Key(),
+			ContentType: contentTypeHTML,
+			Body:        htmlBytes,
+			Modified:    latestLastMod(tag.Pages),
+		})
+	}
+
+	indexKey := tagsDir + "/" + IndexKey
+	htmlBytes, err := b.renderPage(ctx, TagIndexLayout, indexKey, PageData{
+		Page: Page{FrontMatter: FrontMatter{Title: "Tags"}},
+		Tags: tags,
+	}, stylesheets)
+	if err != nil {
+		return nil, err
+	}
+	return append(outputFiles, OutputFile{
+		Key:         indexKey,
+		ContentType: contentTypeHTML,
+		Body:        htmlBytes,
+		Modified:    latestLastMod(sortedPosts(pages)),
+	}), nil
+}
@@ -0,0 +1,48 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Go":              "go",
+		"  AWS Lambda  ":  "aws-lambda",
+		"c++ / systems":   "c-systems",
+		"--already-slug-": "already-slug",
+		"Über Straße":     "über-straße",
+		"!!!":             "",
+	}
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			assert.Equal(t, want, Slugify(in))
+		})
+	}
+}
+
+func TestCollectTags(t *testing.T) {
+	t.Run("should group posts by tag newest first and merge spellings", func(t *testing.T) {
+		pages := []Page{
+			{Key: "a.html", FrontMatter: FrontMatter{Title: "A", Tags: []string{"Go", "aws"}, Created: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			{Key: "b.html", FrontMatter: FrontMatter{Title: "B", Tags: []string{"go", "Go"}, Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			{Key: "c.html", FrontMatter: FrontMatter{Title: "C", Tags: []string{"hidden"}, Layout: ListLayout}},
+		}
+
+		tags := collectTags(pages)
+		require.Len(t, tags, 2)
+
+		assert.Equal(t, "aws", tags[0].Slug)
+		assert.Len(t, tags[0].Pages, 1)
+
+		assert.Equal(t, "go", tags[1].Slug)
+		assert.Equal(t, "go", tags[1].Name)
+		assert.Equal(t, "tags/go/index.html", tags[1].Key())
+		require.Len(t, tags[1].Pages, 2)
+		assert.Equal(t, "b.html", tags[1].Pages[0].Key)
+		assert.Equal(t, "a.html", tags[1].Pages[1].Key)
+	})
+}
@@ -0,0 +1,179 @@
+package build
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+)
+
+// defaultTheme is the complete theme shipped in the binary. Any file in it can be replaced
+// by a file with the same name in the user's theme or layouts directory.
+//
+//go:embed templates
+var defaultTheme embed.FS
+
+const (
+	themeLayoutsDir = "layouts"
+	themeCSSDir     = "css"
+	cssKeyPrefix    = "css/"
+)
+
+var _ ThemeHandler = HandleTheme{}
+
+type (
+	ThemeHandler interface {
+		Layouts() fs.FS
+		GetThemeCSSFiles(ctx context.Context) ([]ReaderWithPath, error)
+	}
+
+	HandleTheme struct {
+		layouts fs.FS
+		css     fs.FS
+	}
+
+	// overlayFS serves every file from the first layer that has it, so a single file can be
+	// overridden by name without copying the rest of the theme.
+	overlayFS []fs.FS
+)
+
+// NewHandleTheme layers the layouts directory over the theme directory over the embedded default theme.
+// Missing directories are skipped.
+func NewHandleTheme(themeDirectory, layoutsDirectory string) (*HandleTheme, error) {
+	embedded, err := fs.Sub(defaultTheme, "templates")
+	if err != nil {
+		return nil, err
+	}
+	embeddedLayouts, err := fs.Sub(embedded, themeLayoutsDir)
+	if err != nil {
+		return nil, err
+	}
+	embeddedCSS, err := fs.Sub(embedded, themeCSSDir)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := overlayFS{}
+	css := overlayFS{}
+	if layoutsDirectory != "" {
+		layouts = append(layouts, os.DirFS(layoutsDirectory))
+	}
+	if themeDirectory != "" {
+		themeFS := os.DirFS(themeDirectory)
+		themeLayouts, err := fs.Sub(themeFS, themeLayoutsDir)
+		if err != nil {
+			return nil, err
+		}
+		themeCSS, err := fs.Sub(themeFS, themeCSSDir)
+		if err != nil {
+			return nil, err
+		}
+		layouts = append(layouts, themeLayouts)
+		css = append(css, themeCSS)
+	}
+
+	return &HandleTheme{
+		layouts: append(layouts, embeddedLayouts),
+		css:     append(css, embeddedCSS),
+	}, nil
+}
+
+func (t HandleTheme) Layouts() fs.FS {
+	return t.layouts
+}
+
+// GetThemeCSSFiles returns the theme stylesheets with Path set to their key in the build output.
+func (t HandleTheme) GetThemeCSSFiles(ctx context.Context) ([]ReaderWithPath, error) {
+	files := make([]ReaderWithPath, 0)
+	err := fs.WalkDir(t.css, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != cssFileExtension {
+			return nil
+		}
+		f, err := t.css.Open(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, ReaderWithPath{
+			Path:   cssKeyPrefix + p,
+			Reader: f,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// mergeCSSFiles returns the theme stylesheets followed by the user's, so the user's are linked
+// last and override the theme. A user stylesheet with the key of a theme stylesheet, such as
+// css/theme.css, replaces it.
+func mergeCSSFiles(theme, user []ReaderWithPath) []ReaderWithPath {
+	userKeys := make(map[string]bool, len(user))
+	for _, file := range user {
+		userKeys[file.Path] = true
+	}
+
+	merged := make([]ReaderWithPath, 0, len(theme)+len(user))
+	for _, file := range theme {
+		if userKeys[file.Path] {
+			slog.Info("css file replaces theme css file", "key", file.Path)
+			file.Reader.Close()
+			continue
+		}
+		merged = append(merged, file)
+	}
+	return append(merged, user...)
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the entries of every layer, preferring the first layer when names collide.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	found := false
+	seen := make(map[string]bool)
+	entries := make([]fs.DirEntry, 0)
+	for _, layer := range o {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			entries = append(entries, entry)
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
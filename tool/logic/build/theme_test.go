@@ -0,0 +1,84 @@
+package build
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTheme_Layouts(t *testing.T) {
+	t.Run("should override a single partial from the layouts directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "partials"), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "partials", "footer.html"), []byte(`<footer>custom footer</footer>`), 0666))
+
+		theme, err := NewHandleTheme(filepath.Join(t.TempDir(), "missing"), dir)
+		require.NoError(t, err)
+		l, err := NewHandleLayout(theme.Layouts(), config.Site{Title: "Test Blog"})
+		require.NoError(t, err)
+
+		html, err := l.RenderPage(context.Background(), DefaultLayout, PageData{Content: "<p>body</p>"})
+		require.NoError(t, err)
+		assert.Contains(t, string(html), "<footer>custom footer</footer>")
+		assert.Contains(t, string(html), `<a class="site-title"`)
+		assert.Contains(t, string(html), "<p>body</p>")
+	})
+	t.Run("should prefer the layouts directory over the theme directory", func(t *testing.T) {
+		themeDir := t.TempDir()
+		layoutsDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(themeDir, "layouts"), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(themeDir, "layouts", "post.html"), []byte(`{{ define "main" }}theme{{ end }}`), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(themeDir, "layouts", "note.html"), []byte(`{{ define "main" }}theme note{{ end }}`), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(layoutsDir, "post.html"), []byte(`{{ define "main" }}layouts{{ end }}`), 0666))
+
+		theme, err := NewHandleTheme(themeDir, layoutsDir)
+		require.NoError(t, err)
+		l, err := NewHandleLayout(theme.Layouts(), config.Site{})
+		require.NoError(t, err)
+
+		html, err := l.RenderPage(context.Background(), DefaultLayout, PageData{})
+		require.NoError(t, err)
+		assert.Contains(t, string(html), "<main class=\"container\">\nlayouts\n</main>")
+
+		html, err = l.RenderPage(context.Background(), "note", PageData{})
+		require.NoError(t, err)
+		assert.Contains(t, string(html), "theme note")
+	})
+}
+
+func TestHandleTheme_GetThemeCSSFiles(t *testing.T) {
+	t.Run("should return embedded theme css", func(t *testing.T) {
+		theme, err := NewHandleTheme("", "")
+		require.NoError(t, err)
+
+		files, err := theme.GetThemeCSSFiles(context.Background())
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, "css/theme.css", files[0].Path)
+	})
+	t.Run("should override theme css by filename and add new files", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "css"), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "css", "theme.css"), []byte(`body{color:red}`), 0666))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "css", "extra.css"), []byte(`p{color:blue}`), 0666))
+
+		theme, err := NewHandleTheme(dir, "")
+		require.NoError(t, err)
+
+		files, err := theme.GetThemeCSSFiles(context.Background())
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		assert.Equal(t, "css/extra.css", files[0].Path)
+		assert.Equal(t, "css/theme.css", files[1].Path)
+
+		b, err := io.ReadAll(files[1].Reader)
+		require.NoError(t, err)
+		assert.Equal(t, "body{color:red}", string(b))
+	})
+}
@@ -0,0 +1,100 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+var ErrUploadsFailed = errors.New("uploads failed")
+
+type (
+	// UploadResult is the outcome of uploading a set of files. Files never attempted because the
+	// context was cancelled are listed as failed with the context error.
+	UploadResult struct {
+		Uploaded []string
+		Failed   []UploadFailure
+	}
+
+	UploadFailure struct {
+		Key string
+		Err error
+	}
+)
+
+// Err joins every failure into one error wrapping ErrUploadsFailed, or returns nil when nothing failed.
+func (r UploadResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(r.Failed))
+	for _, failure := range r.Failed {
+		errs = append(errs, failure.Err)
+	}
+	return fmt.Errorf("%d of %d %w: %w", len(r.Failed), len(r.Failed)+len(r.Uploaded), ErrUploadsFailed, errors.Join(errs...))
+}
+
+// uploadFiles writes files to dest from concurrency workers. One failed file does not stop
+// the others; once ctx is cancelled no new upload is started.
+func (p Publisher) uploadFiles(ctx context.Context, dest target.Target, files []OutputFile, concurrency int) UploadResult {
+	concurrency = max(1, min(concurrency, len(files)))
+
+	jobs := make(chan OutputFile)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result UploadResult
+	)
+	record := func(key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Failed = append(result.Failed, UploadFailure{Key: key, Err: err})
+			return
+		}
+		result.Uploaded = append(result.Uploaded, key)
+	}
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for outputFile := range jobs {
+				if err := ctx.Err(); err != nil {
+					record(outputFile.Key, err)
+					continue
+				}
+				slog.Info("No matching hash, writing file to target", "file", outputFile.Key)
+				err := dest.WriteFile(ctx, outputFile.Key, bytes.NewReader(outputFile.Body), objectOptions(outputFile, p.deploy.Rules))
+				if err != nil {
+					slog.Error("error writing to target", "key", outputFile.Key, "error", err)
+				}
+				record(outputFile.Key, err)
+			}
+		}()
+	}
+
+	for i, outputFile := range files {
+		select {
+		case jobs <- outputFile:
+			continue
+		case <-ctx.Done():
+		}
+		for _, skipped := range files[i:] {
+			record(skipped.Key, ctx.Err())
+		}
+		break
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Strings(result.Uploaded)
+	sort.Slice(result.Failed, func(i, j int) bool { return result.Failed[i].Key < result.Failed[j].Key })
+	return result
+}
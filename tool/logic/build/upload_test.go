@@ -0,0 +1,52 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_uploadFiles(t *testing.T) {
+	files := make([]OutputFile, 0, 20)
+	for i := range 20 {
+		files = append(files, OutputFile{Key: "post-" + strconv.Itoa(i) + ".html", Body: []byte("post")})
+	}
+
+	t.Run("should upload every file and collect each failure", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		dest := &fakeTarget{fail: map[string]error{"post-3.html": errBoom, "post-7.html": errBoom}}
+		publisher := Publisher{}
+
+		result := publisher.uploadFiles(context.Background(), dest, files, 4)
+
+		assert.Len(t, result.Uploaded, 18)
+		require.Len(t, result.Failed, 2)
+		assert.Equal(t, "post-3.html", result.Failed[0].Key)
+		assert.Equal(t, "post-7.html", result.Failed[1].Key)
+		err := result.Err()
+		assert.ErrorIs(t, err, ErrUploadsFailed)
+		assert.ErrorIs(t, err, errBoom)
+	})
+
+	t.Run("should not start uploads once the context is cancelled", func(t *testing.T) {
+		dest := &fakeTarget{}
+		publisher := Publisher{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		result := publisher.uploadFiles(ctx, dest, files, 4)
+
+		assert.Empty(t, dest.written)
+		assert.Len(t, result.Failed, len(files))
+		assert.ErrorIs(t, result.Err(), context.Canceled)
+	})
+
+	t.Run("should succeed without files", func(t *testing.T) {
+		result := Publisher{}.uploadFiles(context.Background(), &fakeTarget{}, nil, 8)
+		assert.NoError(t, result.Err())
+	})
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPath = "blog.yaml"
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+type (
+	// Config is the optional blog.yaml that sits next to the markdown directory.
+	Config struct {
+		Site       Site       `yaml:"site"`
+		Feed       Feed       `yaml:"feed"`
+		Sitemap    Sitemap    `yaml:"sitemap"`
+		Robots     Robots     `yaml:"robots"`
+		Deploy     Deploy     `yaml:"deploy"`
+		S3         S3         `yaml:"s3"`
+		CloudFront CloudFront `yaml:"cloudfront"`
+		Bucket     Bucket     `yaml:"bucket"`
+	}
+
+	// Site holds the values every template receives as .Site.
+	Site struct {
+		Title       string `yaml:"title"`
+		Description string `yaml:"description"`
+		BaseURL     string `yaml:"base_url"`
+		Language    string `yaml:"language"`
+		Author      string `yaml:"author"`
+	}
+
+	// Feed controls the RSS, Atom and JSON feeds.
+	Feed struct {
+		Limit       int  `yaml:"limit"`
+		FullContent bool `yaml:"full_content"`
+	}
+
+	// Sitemap controls sitemap.xml. MaxURLs is the number of urls per file before it is split behind a sitemap index.
+	Sitemap struct {
+		MaxURLs int `yaml:"max_urls"`
+	}
+
+	// Robots controls robots.txt, which always ends with a link to the sitemap.
+	Robots struct {
+		Rules []RobotsRule `yaml:"rules"`
+	}
+	RobotsRule struct {
+		UserAgent string   `yaml:"user_agent"`
+		Allow     []string `yaml:"allow"`
+		Disallow  []string `yaml:"disallow"`
+	}
+
+	// S3 is how to reach the bucket. Endpoint and PathStyle point the client at an S3 compatible
+	// store, Profile picks a profile from the shared aws config and credentials files.
+	S3 struct {
+		Region    string `yaml:"region"`
+		Endpoint  string `yaml:"endpoint"`
+		PathStyle bool   `yaml:"path_style"`
+		Profile   string `yaml:"profile"`
+	}
+
+	// Bucket is how init-bucket sets up the bucket for static website hosting. Access is public-read
+	// to serve the site straight from the bucket, cloudfront to only let the distribution with
+	// DistributionARN read it, or private to let no one. ErrorDocument is a page of the site served
+	// for missing keys, such as a 404.html in the static directory, and left unset by default since
+	// the build does not generate one. BlockPublicACLs blocks and ignores public ACLs, which the
+	// policy makes unnecessary.
+	Bucket struct {
+		IndexDocument   string `yaml:"index_document"`
+		ErrorDocument   string `yaml:"error_document"`
+		Access          string `yaml:"access"`
+		DistributionARN string `yaml:"distribution_arn"`
+		BlockPublicACLs bool   `yaml:"block_public_acls"`
+	}
+
+	// CloudFront invalidates the cached copies of the files a deploy uploaded or deleted. Paths
+	// collapse to wildcards when there are more than MaxPaths of them. Wait blocks the deploy
+	// until the invalidation has completed, for at most WaitTimeout.
+	CloudFront struct {
+		DistributionID string        `yaml:"distribution_id"`
+		MaxPaths       int           `yaml:"max_paths"`
+		Wait           bool          `yaml:"wait"`
+		WaitTimeout    time.Duration `yaml:"wait_timeout"`
+	}
+
+	// Deploy controls how the target is brought in line with the build. Target is a url such as
+	// s3://bucket/prefix, file:///srv/www or mem://.
+	// Prefix places the site below a key prefix when the target is given as a bucket name.
+	// Concurrency is the number of files uploaded at the same time, and MaxAttempts how often an
+	// upload failing with a transient error is tried before giving up.
+	// Prune deletes remote keys that are no longer built, unless they match one of the Protected
+	// patterns. A deploy that would prune more than MaxPruneRatio of the remote objects is aborted.
+	// Releases uploads every deploy as a separate release and switches to it in one step.
+	// Rules set headers and metadata on the uploaded files, and Force uploads every file even when
+	// the target already holds it, so changed rules reach files whose content did not change.
+	// Compression is gzip or br to build html, css, js, xml and json compressed with that
+	// encoding, or empty to leave them uncompressed.
+	Deploy struct {
+		Target        string       `yaml:"target"`
+		Prefix        string       `yaml:"prefix"`
+		Concurrency   int          `yaml:"concurrency"`
+		MaxAttempts   int          `yaml:"max_attempts"`
+		Prune         bool         `yaml:"prune"`
+		MaxPruneRatio float64      `yaml:"max_prune_ratio"`
+		Protected     []string     `yaml:"protected"`
+		Releases      Releases     `yaml:"releases"`
+		Rules         []ObjectRule `yaml:"rules"`
+		Force         bool         `yaml:"force"`
+		Compression   string       `yaml:"compression"`
+	}
+
+	// ObjectRule sets the headers, storage class and user metadata of the files whose key matches
+	// Match. A pattern with a slash is matched against the whole key with path.Match, one without
+	// against the file name in any directory, and one ending in a slash matches everything below
+	// that prefix. Every matching rule applies in order, so a later rule overrides the fields an
+	// earlier one set and adds to its metadata.
+	ObjectRule struct {
+		Match              string            `yaml:"match"`
+		CacheControl       string            `yaml:"cache_control"`
+		ContentDisposition string            `yaml:"content_disposition"`
+		ContentEncoding    string            `yaml:"content_encoding"`
+		StorageClass       string            `yaml:"storage_class"`
+		Metadata           map[string]string `yaml:"metadata"`
+	}
+
+	// Releases keeps every deploy below releases/<id>/ on the target, where id defaults to the
+	// deploy time. Keep is the number of releases retained besides the active one, older ones are
+	// deleted after each deploy. Zero keeps every release.
+	Releases struct {
+		Enabled bool `yaml:"enabled"`
+		Keep    int  `yaml:"keep"`
+	}
+)
+
+func Default() Config {
+	return Config{
+		Site: Site{
+			Title:    "Blog",
+			Language: "en",
+		},
+		Feed: Feed{
+			Limit: 20,
+		},
+		Sitemap: Sitemap{
+			MaxURLs: 50000,
+		},
+		Robots: Robots{
+			Rules: []RobotsRule{{UserAgent: "*", Allow: []string{"/"}}},
+		},
+		S3: S3{
+			Region: "us-east-2",
+		},
+		Bucket: Bucket{
+			IndexDocument:   "index.html",
+			Access:          "public-read",
+			BlockPublicACLs: true,
+		},
+		CloudFront: CloudFront{
+			MaxPaths:    20,
+			WaitTimeout: 15 * time.Minute,
+		},
+		Deploy: Deploy{
+			Concurrency:   8,
+			MaxAttempts:   5,
+			MaxPruneRatio: 0.25,
+			Releases: Releases{
+				Keep: 5,
+			},
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults. A missing file is not an error.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no config file found, using defaults", "path", path)
+		return cfg, nil
+	}
+	if err != nil {
+		slog.Error("error reading config file", "path", path, "error", err)
+		return Config{}, err
+	}
+
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return Config{}, fmt.Errorf("error decoding config file %s: %w - %w", path, err, ErrInvalidConfig)
+	}
+	return cfg, nil
+}
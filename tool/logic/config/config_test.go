@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("should use the defaults without a config file", func(t *testing.T) {
+		cfg, err := Load(filepath.Join(t.TempDir(), DefaultPath))
+		require.NoError(t, err)
+		assert.Equal(t, Default(), cfg)
+		assert.Empty(t, cfg.Bucket.ErrorDocument, "the build generates no error page")
+	})
+
+	t.Run("should read the file on top of the defaults", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), DefaultPath)
+		require.NoError(t, os.WriteFile(path, []byte(`
+site:
+  base_url: https://blog.example.com/
+deploy:
+  target: s3://my-blog/
+  releases:
+    enabled: true
+s3:
+  endpoint: http://127.0.0.1:9000
+  path_style: true
+`), 0666))
+
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		want := Default()
+		want.Site.BaseURL = "https://blog.example.com/"
+		want.Deploy.Target = "s3://my-blog/"
+		want.Deploy.Releases.Enabled = true
+		want.S3.Endpoint = "http://127.0.0.1:9000"
+		want.S3.PathStyle = true
+		assert.Equal(t, want, cfg)
+	})
+
+	t.Run("should reject a file that is not valid yaml", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), DefaultPath)
+		require.NoError(t, os.WriteFile(path, []byte("deploy: [unclosed"), 0666))
+
+		_, err := Load(path)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+}
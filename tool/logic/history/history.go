@@ -0,0 +1,205 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+const (
+	// Prefix is the reserved key prefix deploy records are kept below, one Prefix + <id> + ".json"
+	// per deploy. It starts with a dot so it is never mistaken for part of the site, but it sits
+	// in the site root: a public bucket or a directory served as is serves the records too.
+	Prefix = ".deploys/"
+	// IDFormat is the time layout of a record id, which sorts in deploy order.
+	IDFormat = "20060102T150405.000Z"
+
+	ActionAdd    = "add"
+	ActionChange = "change"
+	ActionDelete = "delete"
+)
+
+var ErrUnknownDeploy = errors.New("unknown deploy")
+
+type (
+	// Record describes one successful deploy. Files holds the md5 of every file of the site by
+	// key after the deploy, Uploaded and Deleted the keys the deploy changed.
+	Record struct {
+		ID       string            `json:"id"`
+		Time     time.Time         `json:"time"`
+		Version  string            `json:"version"`
+		Commit   string            `json:"commit,omitempty"`
+		Release  string            `json:"release,omitempty"`
+		Files    map[string]string `json:"files"`
+		Uploaded []string          `json:"uploaded"`
+		Deleted  []string          `json:"deleted"`
+	}
+
+	// Change is a key that differs between two deploys.
+	Change struct {
+		Key    string `json:"key"`
+		Action string `json:"action"`
+	}
+
+	// Log reads and writes the deploy records kept on a target.
+	Log struct {
+		dest target.Target
+	}
+)
+
+func NewLog(dest target.Target) *Log {
+	return &Log{
+		dest: dest,
+	}
+}
+
+// Save writes record to the target, giving it an id from its time when it has none.
+func (l Log) Save(ctx context.Context, record Record) (Record, error) {
+	if record.ID == "" {
+		record.ID = record.Time.UTC().Format(IDFormat)
+	}
+	if record.Uploaded == nil {
+		record.Uploaded = []string{}
+	}
+	if record.Deleted == nil {
+		record.Deleted = []string{}
+	}
+
+	b, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return Record{}, err
+	}
+	if err := l.dest.WriteFile(ctx, keyOf(record.ID), strings.NewReader(string(b)+"\n"), target.ObjectOptions{ContentType: "application/json"}); err != nil {
+		slog.Error("error writing deploy record", "id", record.ID, "error", err)
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// Load reads the record of deploy id.
+func (l Log) Load(ctx context.Context, id string) (Record, error) {
+	b, err := l.dest.ReadFile(ctx, keyOf(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Record{}, fmt.Errorf("deploy %s: %w", id, ErrUnknownDeploy)
+	}
+	if err != nil {
+		slog.Error("error reading deploy record", "id", id, "error", err)
+		return Record{}, err
+	}
+	var record Record
+	if err := json.Unmarshal(b, &record); err != nil {
+		return Record{}, fmt.Errorf("error decoding deploy record %s: %w", id, err)
+	}
+	return record, nil
+}
+
+// List returns every deploy record, oldest first. Only the keys below Prefix are listed.
+func (l Log) List(ctx context.Context) ([]Record, error) {
+	keys, err := target.ListKeys(ctx, l.dest, Prefix)
+	if err != nil {
+		slog.Error("error listing deploy records", "error", err)
+		return nil, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name, ok := strings.CutPrefix(key, Prefix); ok && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(ids)
+
+	records := make([]Record, 0, len(ids))
+	for _, id := range ids {
+		record, err := l.Load(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Touching returns the records of the deploys that added, changed or deleted key, oldest first.
+// The hash of key is compared with the deploy before, since with releases every deploy uploads
+// every key to a new release.
+func Touching(records []Record, key string) []Record {
+	touching := make([]Record, 0)
+	var previous Record
+	for _, record := range records {
+		hash, ok := record.Files[key]
+		previousHash, previousOK := previous.Files[key]
+		if ok != previousOK || hash != previousHash {
+			touching = append(touching, record)
+		}
+		previous = record
+	}
+	return touching
+}
+
+// Diff returns the keys added, changed and deleted going from one deploy to another, sorted by key.
+func Diff(from, to Record) []Change {
+	changes := make([]Change, 0)
+	for key, hash := range to.Files {
+		fromHash, ok := from.Files[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: key, Action: ActionAdd})
+		case fromHash != hash:
+			changes = append(changes, Change{Key: key, Action: ActionChange})
+		}
+	}
+	for key := range from.Files {
+		if _, ok := to.Files[key]; !ok {
+			changes = append(changes, Change{Key: key, Action: ActionDelete})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// WriteList prints records as a table of id, commit, release and the number of keys uploaded and deleted.
+func WriteList(w io.Writer, records []Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, record := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d uploaded\t%d deleted\n",
+			record.ID, orDash(shortCommit(record.Commit)), orDash(record.Release), len(record.Uploaded), len(record.Deleted))
+	}
+	return tw.Flush()
+}
+
+// WriteDiff prints changes as a table of action and key.
+func WriteDiff(w io.Writer, changes []Change) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, change := range changes {
+		fmt.Fprintf(tw, "%s\t%s\n", change.Action, change.Key)
+	}
+	return tw.Flush()
+}
+
+func keyOf(id string) string {
+	return Prefix + id + ".json"
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
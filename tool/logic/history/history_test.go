@@ -0,0 +1,91 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	t.Run("should save records below the reserved prefix and list them oldest first", func(t *testing.T) {
+		dest := target.NewMemory()
+		require.NoError(t, dest.WriteFile(ctx, "index.html", bytes.NewReader(nil), target.ObjectOptions{ContentType: "text/html"}))
+		deployLog := NewLog(dest)
+
+		second, err := deployLog.Save(ctx, Record{Time: start.Add(time.Hour), Version: "v1", Files: map[string]string{"index.html": "b"}, Uploaded: []string{"index.html"}})
+		require.NoError(t, err)
+		first, err := deployLog.Save(ctx, Record{Time: start, Version: "v1", Commit: "abc", Files: map[string]string{"index.html": "a"}})
+		require.NoError(t, err)
+		assert.Equal(t, "20261017T090000.000Z", first.ID)
+		assert.Equal(t, []string{Prefix + first.ID + ".json", Prefix + second.ID + ".json", "index.html"}, dest.Keys())
+
+		records, err := deployLog.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []Record{first, second}, records)
+		assert.Equal(t, []string{}, records[0].Deleted)
+	})
+
+	t.Run("should report unknown deploys", func(t *testing.T) {
+		_, err := NewLog(target.NewMemory()).Load(ctx, "missing")
+		assert.ErrorIs(t, err, ErrUnknownDeploy)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	from := Record{Files: map[string]string{"index.html": "a", "post.html": "a", "old.html": "a"}}
+	to := Record{Files: map[string]string{"index.html": "b", "post.html": "a", "new.html": "a"}}
+
+	assert.Equal(t, []Change{
+		{Key: "index.html", Action: ActionChange},
+		{Key: "new.html", Action: ActionAdd},
+		{Key: "old.html", Action: ActionDelete},
+	}, Diff(from, to))
+	assert.Empty(t, Diff(to, to))
+}
+
+func TestTouching(t *testing.T) {
+	t.Run("should list the deploys that added, changed or deleted the key", func(t *testing.T) {
+		records := []Record{
+			{ID: "1", Files: map[string]string{"index.html": "a", "post.html": "a"}, Uploaded: []string{"index.html", "post.html"}},
+			{ID: "2", Files: map[string]string{"index.html": "b", "post.html": "a"}, Uploaded: []string{"index.html"}},
+			{ID: "3", Files: map[string]string{"index.html": "b"}, Deleted: []string{"post.html"}},
+		}
+		assert.Equal(t, []string{"1", "3"}, ids(Touching(records, "post.html")))
+	})
+
+	t.Run("should compare hashes when releases upload every key", func(t *testing.T) {
+		records := []Record{
+			{ID: "1", Release: "r1", Files: map[string]string{"index.html": "a", "post.html": "a"}, Uploaded: []string{"index.html", "post.html"}},
+			{ID: "2", Release: "r2", Files: map[string]string{"index.html": "b", "post.html": "a"}, Uploaded: []string{"index.html", "post.html"}},
+			{ID: "3", Release: "r3", Files: map[string]string{"index.html": "b", "post.html": "a"}, Uploaded: []string{"index.html", "post.html"}},
+		}
+		assert.Equal(t, []string{"1", "2"}, ids(Touching(records, "index.html")))
+		assert.Equal(t, []string{"1"}, ids(Touching(records, "post.html")))
+	})
+}
+
+func ids(records []Record) []string {
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+func TestWriteList(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteList(&out, []Record{
+		{ID: "1", Commit: "0123456789abcdef", Uploaded: []string{"a"}},
+		{ID: "2", Release: "v2", Deleted: []string{"a", "b"}},
+	}))
+	assert.Equal(t, "1  0123456789ab  -   1 uploaded  0 deleted\n"+
+		"2  -             v2  0 uploaded  2 deleted\n", out.String())
+}
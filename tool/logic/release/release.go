@@ -0,0 +1,314 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+)
+
+const (
+	// Prefix is the key prefix every release is uploaded below, as Prefix + <id> + "/".
+	Prefix = "releases/"
+	// IndexKey lists the retained releases. It sits next to the release directories rather than
+	// inside one, so it is never part of a release.
+	IndexKey = Prefix + "index.json"
+	// IDFormat is the time layout of the default release id, which sorts in deploy order.
+	IDFormat = "20060102T150405Z"
+)
+
+var (
+	ErrUnsupported    = errors.New("target does not support releases")
+	ErrInvalidID      = errors.New("invalid release id")
+	ErrUnknownRelease = errors.New("unknown release")
+	ErrReleaseExists  = errors.New("release already exists")
+	ErrNoRollback     = errors.New("no earlier release to roll back to")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type (
+	// Release is one complete copy of the site kept on the target.
+	Release struct {
+		ID      string    `json:"id"`
+		Created time.Time `json:"created"`
+		Active  bool      `json:"-"`
+	}
+
+	index struct {
+		Releases []Release `json:"releases"`
+	}
+
+	// Manager uploads releases to a target, switches between them and removes old ones.
+	Manager struct {
+		dest     target.Target
+		releaser target.Releaser
+	}
+)
+
+// NewManager returns a manager for dest, which has to be a target.Releaser.
+func NewManager(dest target.Target) (*Manager, error) {
+	releaser, ok := dest.(target.Releaser)
+	if !ok {
+		return nil, fmt.Errorf("%T: %w", dest, ErrUnsupported)
+	}
+	return &Manager{
+		dest:     dest,
+		releaser: releaser,
+	}, nil
+}
+
+// NewID returns the default id of a release deployed at now.
+func NewID(now time.Time) string {
+	return now.UTC().Format(IDFormat)
+}
+
+// ValidateID makes sure id can be used as a single path segment, such as a timestamp or git sha.
+func ValidateID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("%q may only hold letters, digits, dots, dashes and underscores: %w", id, ErrInvalidID)
+	}
+	if Prefix+id == IndexKey {
+		return fmt.Errorf("%q is the name of the release index: %w", id, ErrInvalidID)
+	}
+	return nil
+}
+
+// Target returns the part of the target holding the release id.
+func (m Manager) Target(id string) target.Target {
+	return target.WithPrefix(m.dest, prefixOf(id))
+}
+
+// Publish uploads a release with publish, records it and then makes it the active release. The
+// release is only served once publish succeeds, so a failed deploy leaves the live site untouched.
+// An id that is already retained is refused, as uploading into it could change the live site.
+func (m Manager) Publish(ctx context.Context, id string, created time.Time, publish func(ctx context.Context, dest target.Target) error) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+	idx, err := m.readIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if indexOf(idx.Releases, id) >= 0 {
+		return fmt.Errorf("release %s, deploy with a new id or roll back to it: %w", id, ErrReleaseExists)
+	}
+	if err := publish(ctx, m.Target(id)); err != nil {
+		return err
+	}
+
+	idx.Releases = append(idx.Releases, Release{ID: id, Created: created.UTC()})
+	if err := m.writeIndex(ctx, idx); err != nil {
+		return err
+	}
+	return m.Activate(ctx, id)
+}
+
+// List returns the retained releases, oldest first, with the one being served marked Active.
+func (m Manager) List(ctx context.Context) ([]Release, error) {
+	idx, err := m.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	active, err := m.active(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range idx.Releases {
+		idx.Releases[i].Active = idx.Releases[i].ID == active
+	}
+	return idx.Releases, nil
+}
+
+// Active returns the release being served, and false when none is.
+func (m Manager) Active(ctx context.Context) (Release, bool, error) {
+	releases, err := m.List(ctx)
+	if err != nil {
+		return Release{}, false, err
+	}
+	for _, r := range releases {
+		if r.Active {
+			return r, true, nil
+		}
+	}
+	return Release{}, false, nil
+}
+
+// Activate switches the target to the retained release id.
+func (m Manager) Activate(ctx context.Context, id string) error {
+	idx, err := m.readIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if indexOf(idx.Releases, id) < 0 {
+		return fmt.Errorf("release %s: %w", id, ErrUnknownRelease)
+	}
+	if err := m.releaser.Activate(ctx, prefixOf(id)); err != nil {
+		slog.Error("error activating release", "release", id, "error", err)
+		return err
+	}
+	slog.Info("activated release", "release", id)
+	return nil
+}
+
+// Rollback activates release id, or when id is empty the release deployed before the active one.
+func (m Manager) Rollback(ctx context.Context, id string) (Release, error) {
+	releases, err := m.List(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	var i int
+	if id != "" {
+		i = indexOf(releases, id)
+		if i < 0 {
+			return Release{}, fmt.Errorf("release %s: %w", id, ErrUnknownRelease)
+		}
+	} else {
+		i = slices.IndexFunc(releases, func(r Release) bool { return r.Active }) - 1
+		if i < 0 {
+			return Release{}, ErrNoRollback
+		}
+	}
+
+	if err := m.Activate(ctx, releases[i].ID); err != nil {
+		return Release{}, err
+	}
+	releases[i].Active = true
+	return releases[i], nil
+}
+
+// Prune deletes all but the keep newest releases. The active release is always kept and does not
+// count against keep, and a keep of zero keeps every release. It returns the ids of the deleted
+// releases.
+func (m Manager) Prune(ctx context.Context, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	releases, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	retained := 0
+	for i := len(releases) - 1; i >= 0; i-- {
+		switch {
+		case releases[i].Active:
+		case retained < keep:
+			retained++
+		default:
+			stale = append(stale, releases[i].ID)
+		}
+	}
+
+	var removed []string
+	for _, id := range stale {
+		if err = m.deleteRelease(ctx, id); err != nil {
+			break
+		}
+		removed = append(removed, id)
+	}
+	if len(removed) == 0 {
+		return nil, err
+	}
+
+	// the index is written even after a failed delete, so it lists what is left on the target
+	kept := slices.DeleteFunc(releases, func(r Release) bool { return slices.Contains(removed, r.ID) })
+	sort.Strings(removed)
+	return removed, errors.Join(err, m.writeIndex(ctx, index{Releases: kept}))
+}
+
+func (m Manager) deleteRelease(ctx context.Context, id string) error {
+	keys, err := target.ListKeys(ctx, m.dest, prefixOf(id))
+	if err != nil {
+		return err
+	}
+	if err := m.dest.DeleteFiles(ctx, keys); err != nil {
+		slog.Error("error deleting release", "release", id, "error", err)
+		return err
+	}
+	slog.Info("deleted release", "release", id, "files", len(keys))
+	return nil
+}
+
+// active returns the id of the release being served, or "" when the target serves none.
+func (m Manager) active(ctx context.Context) (string, error) {
+	prefix, err := m.releaser.Active(ctx)
+	if err != nil {
+		return "", err
+	}
+	id, ok := strings.CutPrefix(prefix, Prefix)
+	if !ok {
+		return "", nil
+	}
+	return strings.TrimSuffix(id, "/"), nil
+}
+
+func (m Manager) readIndex(ctx context.Context) (index, error) {
+	b, err := m.dest.ReadFile(ctx, IndexKey)
+	if errors.Is(err, fs.ErrNotExist) {
+		return index{}, nil
+	}
+	if err != nil {
+		slog.Error("error reading release index", "error", err)
+		return index{}, err
+	}
+	var idx index
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return index{}, fmt.Errorf("error decoding release index %s: %w", IndexKey, err)
+	}
+	return idx, nil
+}
+
+func (m Manager) writeIndex(ctx context.Context, idx index) error {
+	if idx.Releases == nil {
+		idx.Releases = []Release{}
+	}
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := m.dest.WriteFile(ctx, IndexKey, strings.NewReader(string(b)+"\n"), target.ObjectOptions{ContentType: "application/json"}); err != nil {
+		slog.Error("error writing release index", "error", err)
+		return err
+	}
+	return nil
+}
+
+func prefixOf(id string) string {
+	return Prefix + id + "/"
+}
+
+func indexOf(releases []Release, id string) int {
+	for i, r := range releases {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteList prints releases as a table, marking the active one with an asterisk.
+func WriteList(w io.Writer, releases []Release) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range releases {
+		marker := " "
+		if r.Active {
+			marker = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", marker, r.ID, r.Created.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,185 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmarken5/blog-builder/tool/logic/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deploy publishes a release holding a single index.html.
+func deploy(t *testing.T, manager *Manager, id string, created time.Time) {
+	t.Helper()
+	err := manager.Publish(context.Background(), id, created, func(ctx context.Context, dest target.Target) error {
+		return dest.WriteFile(ctx, "index.html", strings.NewReader(id), target.ObjectOptions{ContentType: "text/html"})
+	})
+	require.NoError(t, err)
+}
+
+func ids(releases []Release) []string {
+	out := make([]string, 0, len(releases))
+	for _, r := range releases {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	t.Run("should upload below the release prefix and activate it", func(t *testing.T) {
+		dest := target.NewMemory()
+		manager, err := NewManager(dest)
+		require.NoError(t, err)
+
+		deploy(t, manager, "a", start)
+		deploy(t, manager, "b", start.Add(time.Hour))
+
+		assert.Equal(t, []string{"releases/a/index.html", "releases/b/index.html", IndexKey}, dest.Keys())
+		prefix, err := dest.Active(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "releases/b/", prefix)
+
+		releases, err := manager.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []Release{{ID: "a", Created: start}, {ID: "b", Created: start.Add(time.Hour), Active: true}}, releases)
+	})
+
+	t.Run("should leave the active release alone when the upload fails", func(t *testing.T) {
+		dest := target.NewMemory()
+		manager, err := NewManager(dest)
+		require.NoError(t, err)
+		deploy(t, manager, "a", start)
+
+		errUpload := errors.New("upload failed")
+		err = manager.Publish(ctx, "b", start, func(ctx context.Context, dest target.Target) error { return errUpload })
+		assert.ErrorIs(t, err, errUpload)
+
+		active, ok, err := manager.Active(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "a", active.ID)
+	})
+
+	t.Run("should refuse to upload into a release it already has", func(t *testing.T) {
+		dest := target.NewMemory()
+		manager, err := NewManager(dest)
+		require.NoError(t, err)
+		deploy(t, manager, "a", start)
+		deploy(t, manager, "b", start.Add(time.Hour))
+
+		for _, id := range []string{"a", "b"} {
+			err = manager.Publish(ctx, id, start, func(ctx context.Context, dest target.Target) error {
+				return dest.WriteFile(ctx, "index.html", strings.NewReader("changed"), target.ObjectOptions{})
+			})
+			assert.ErrorIs(t, err, ErrReleaseExists, id)
+		}
+		b, err := dest.ReadFile(ctx, "releases/b/index.html")
+		require.NoError(t, err)
+		assert.Equal(t, "b", string(b))
+	})
+
+	t.Run("should reject ids that are not a single path segment", func(t *testing.T) {
+		manager, err := NewManager(target.NewMemory())
+		require.NoError(t, err)
+		for _, id := range []string{"", "../a", "a/b", ".hidden", "index.json"} {
+			err := manager.Publish(ctx, id, start, func(ctx context.Context, dest target.Target) error { return nil })
+			assert.ErrorIs(t, err, ErrInvalidID, id)
+		}
+	})
+
+	t.Run("should roll back to the previous or a given release", func(t *testing.T) {
+		manager, err := NewManager(target.NewMemory())
+		require.NoError(t, err)
+
+		_, err = manager.Rollback(ctx, "")
+		assert.ErrorIs(t, err, ErrNoRollback)
+
+		for i, id := range []string{"a", "b", "c"} {
+			deploy(t, manager, id, start.Add(time.Duration(i)*time.Hour))
+		}
+
+		rolledBack, err := manager.Rollback(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, "b", rolledBack.ID)
+		rolledBack, err = manager.Rollback(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, "a", rolledBack.ID)
+		_, err = manager.Rollback(ctx, "")
+		assert.ErrorIs(t, err, ErrNoRollback)
+
+		rolledBack, err = manager.Rollback(ctx, "c")
+		require.NoError(t, err)
+		assert.Equal(t, "c", rolledBack.ID)
+		_, err = manager.Rollback(ctx, "missing")
+		assert.ErrorIs(t, err, ErrUnknownRelease)
+	})
+
+	t.Run("should prune the oldest releases but never the active one", func(t *testing.T) {
+		dest := target.NewMemory()
+		manager, err := NewManager(dest)
+		require.NoError(t, err)
+		for i, id := range []string{"a", "b", "c", "d"} {
+			deploy(t, manager, id, start.Add(time.Duration(i)*time.Hour))
+		}
+		_, err = manager.Rollback(ctx, "a")
+		require.NoError(t, err)
+
+		removed, err := manager.Prune(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "c"}, removed)
+
+		releases, err := manager.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "d"}, ids(releases))
+		assert.Equal(t, []string{"releases/a/index.html", "releases/d/index.html", IndexKey}, dest.Keys())
+
+		removed, err = manager.Prune(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+	})
+
+	t.Run("should keep every release with a keep of zero", func(t *testing.T) {
+		dest := target.NewMemory()
+		manager, err := NewManager(dest)
+		require.NoError(t, err)
+		for i, id := range []string{"a", "b", "c"} {
+			deploy(t, manager, id, start.Add(time.Duration(i)*time.Hour))
+		}
+		_, err = manager.Rollback(ctx, "b")
+		require.NoError(t, err)
+
+		removed, err := manager.Prune(ctx, 0)
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+
+		releases, err := manager.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, ids(releases))
+	})
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := NewManager(target.WithPrefix(target.NewMemory(), "site/"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestNewID(t *testing.T) {
+	id := NewID(time.Date(2026, 10, 17, 9, 30, 5, 0, time.FixedZone("EST", -5*60*60)))
+	assert.Equal(t, "20261017T143005Z", id)
+	assert.NoError(t, ValidateID(id))
+}
+
+func TestWriteList(t *testing.T) {
+	var out bytes.Buffer
+	created := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, WriteList(&out, []Release{{ID: "a", Created: created}, {ID: "bb", Created: created, Active: true}}))
+	assert.Equal(t, "   a   2026-10-17T09:00:00Z\n*  bb  2026-10-17T09:00:00Z\n", out.String())
+}
@@ -0,0 +1,220 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// currentLink is the symlink in the directory pointing at the active release. With releases the
+// web server serves <root>/current instead of the root itself.
+const currentLink = "current"
+
+// Directory publishes the site to a local directory, such as the document root of a web server.
+type Directory struct {
+	root string
+}
+
+func NewDirectory(root string) *Directory {
+	return &Directory{
+		root: root,
+	}
+}
+
+// GetHashes hashes every file below the directory. A missing directory is empty.
+func (d Directory) GetHashes(ctx context.Context) (map[string]string, error) {
+	return d.HashPrefix(ctx, "")
+}
+
+// HashPrefix hashes the files whose key starts with prefix, walking only the directory prefix
+// names.
+func (d Directory) HashPrefix(ctx context.Context, prefix string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := d.walk(prefix, func(key, path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash, err := calcMD5(f)
+		if err != nil {
+			return err
+		}
+		hashes[key] = hash
+		return nil
+	})
+	if err != nil {
+		slog.Error("error hashing target directory", "path", d.root, "prefix", prefix, "error", err)
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// ListKeys returns the keys of the files below the directory that start with prefix, walking only
+// the directory prefix names.
+func (d Directory) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	err := d.walk(prefix, func(key, path string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		slog.Error("error listing target directory", "path", d.root, "prefix", prefix, "error", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// walk calls fn with the key and path of every regular file whose key starts with prefix. A
+// missing directory holds no files.
+func (d Directory) walk(prefix string, fn func(key, path string) error) error {
+	dir := "."
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	start, err := d.path(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(start, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == start {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		// symlinks such as the current release are not part of any release
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			return fn(key, path)
+		}
+		return nil
+	})
+}
+
+func (d Directory) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// WriteFile writes file to key. Headers and metadata have no place in a directory and are left to
+// the web server.
+func (d Directory) WriteFile(ctx context.Context, key string, file io.Reader, opts ObjectOptions) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+
+	// write next to the final file and rename, so the web server never serves a half written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	return nil
+}
+
+// DeleteFiles removes keys from the directory along with any directory they leave empty. Keys
+// that are already gone are not an error.
+func (d Directory) DeleteFiles(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		path, err := d.path(key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error deleting file %s: %w - %w", key, err, ErrDeleteFile)
+		}
+		d.removeEmptyParents(path)
+	}
+	return nil
+}
+
+// removeEmptyParents removes the directories above path that are left empty, stopping at the root.
+func (d Directory) removeEmptyParents(path string) {
+	// path is always below the root, so walking up reaches it
+	root := filepath.Clean(d.root)
+	for dir := filepath.Dir(path); dir != root && dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// Activate points the current symlink at the release below prefix. The new link is made next to
+// the old one and renamed over it, so the web server sees either the old or the new release.
+func (d Directory) Activate(ctx context.Context, prefix string) error {
+	releaseDir, err := d.path(prefix)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(releaseDir); err != nil {
+		return fmt.Errorf("error activating release %s: %w", prefix, err)
+	}
+
+	link := filepath.Join(d.root, currentLink)
+	tmp := link + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// a relative link keeps working when the directory is moved or mounted elsewhere
+	if err := os.Symlink(filepath.FromSlash(strings.TrimSuffix(prefix, "/")), tmp); err != nil {
+		return fmt.Errorf("error activating release %s: %w", prefix, err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error activating release %s: %w", prefix, err)
+	}
+	return nil
+}
+
+// Active returns the prefix the current symlink points at.
+func (d Directory) Active(ctx context.Context) (string, error) {
+	dest, err := os.Readlink(filepath.Join(d.root, currentLink))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(dest) + "/", nil
+}
+
+// path resolves key below the directory, refusing keys that would escape it.
+func (d Directory) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("key %s is outside the target directory: %w", key, ErrInvalidTarget)
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,124 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Memory keeps the published site in memory. It is safe for concurrent use.
+	Memory struct {
+		mu      sync.Mutex
+		objects map[string]Object
+		active  string
+	}
+
+	Object struct {
+		ObjectOptions
+		Body []byte
+	}
+)
+
+func NewMemory() *Memory {
+	return &Memory{
+		objects: make(map[string]Object),
+	}
+}
+
+func (m *Memory) GetHashes(ctx context.Context) (map[string]string, error) {
+	return m.HashPrefix(ctx, "")
+}
+
+func (m *Memory) HashPrefix(ctx context.Context, prefix string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashes := make(map[string]string)
+	for key, object := range m.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		hash, err := calcMD5(bytes.NewReader(object.Body))
+		if err != nil {
+			return nil, err
+		}
+		hashes[key] = hash
+	}
+	return hashes, nil
+}
+
+func (m *Memory) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for _, key := range m.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *Memory) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	object, ok := m.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("error reading file %s: %w", key, fs.ErrNotExist)
+	}
+	return object.Body, nil
+}
+
+func (m *Memory) WriteFile(ctx context.Context, key string, file io.Reader, opts ObjectOptions) error {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("error writing file %s: %w - %w", key, err, ErrWriteFile)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = Object{ObjectOptions: opts, Body: body}
+	return nil
+}
+
+func (m *Memory) DeleteFiles(ctx context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.objects, key)
+	}
+	return nil
+}
+
+func (m *Memory) Activate(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = prefix
+	return nil
+}
+
+func (m *Memory) Active(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active, nil
+}
+
+// Get returns the object stored at key.
+func (m *Memory) Get(key string) (Object, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	object, ok := m.objects[key]
+	return object, ok
+}
+
+// Keys returns every stored key, sorted.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,252 @@
+package target
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/rmarken5/blog-builder/tool/logic/aws"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+)
+
+const (
+	SchemeS3     = "s3"
+	SchemeFile   = "file"
+	SchemeMemory = "mem"
+)
+
+var (
+	ErrInvalidTarget = errors.New("invalid target")
+	ErrWriteFile     = errors.New("error writing file to target")
+	ErrDeleteFile    = errors.New("error deleting file from target")
+)
+
+var (
+	_ Target   = (*aws.Client)(nil)
+	_ Target   = (*Directory)(nil)
+	_ Target   = (*Memory)(nil)
+	_ Releaser = (*aws.Client)(nil)
+	_ Releaser = (*Directory)(nil)
+	_ Releaser = (*Memory)(nil)
+	_ Lister   = (*aws.Client)(nil)
+	_ Lister   = (*Directory)(nil)
+	_ Lister   = (*Memory)(nil)
+	_ Lister   = prefixed{}
+	_ Hasher   = (*aws.Client)(nil)
+	_ Hasher   = (*Directory)(nil)
+	_ Hasher   = (*Memory)(nil)
+	_ Hasher   = prefixed{}
+)
+
+// ObjectOptions are the headers, storage class and metadata a file is written with. Targets keep
+// what they can represent and ignore the rest.
+type ObjectOptions = aws.ObjectOptions
+
+type (
+	// Target is somewhere a built site is published to. Keys are slash separated and relative to the
+	// root of the site.
+	Target interface {
+		// GetHashes returns the hex md5 of every file currently published.
+		GetHashes(ctx context.Context) (map[string]string, error)
+		// ReadFile returns the content of key, or an error wrapping fs.ErrNotExist when there is none.
+		ReadFile(ctx context.Context, key string) ([]byte, error)
+		WriteFile(ctx context.Context, key string, file io.Reader, opts ObjectOptions) error
+		DeleteFiles(ctx context.Context, keys []string) error
+	}
+
+	// Releaser is a target that can keep several complete copies of the site below key prefixes,
+	// such as releases/<id>/, and switch which one is served in a single step.
+	Releaser interface {
+		// Activate starts serving the release below prefix.
+		Activate(ctx context.Context, prefix string) error
+		// Active returns the prefix being served, or "" when no release is.
+		Active(ctx context.Context) (string, error)
+	}
+
+	// Lister is a target that can list the keys below a prefix without hashing every file.
+	Lister interface {
+		// ListKeys returns the keys starting with prefix.
+		ListKeys(ctx context.Context, prefix string) ([]string, error)
+	}
+
+	// Hasher is a target that can hash the files below a prefix without hashing every file.
+	Hasher interface {
+		// HashPrefix returns the hex md5 of every file whose key starts with prefix.
+		HashPrefix(ctx context.Context, prefix string) (map[string]string, error)
+	}
+
+	// prefixed is the part of a target below a key prefix.
+	prefixed struct {
+		Target
+		prefix string
+	}
+)
+
+// WithPrefix returns a view of the keys of dest below prefix, which ends in a slash.
+func WithPrefix(dest Target, prefix string) Target {
+	return prefixed{Target: dest, prefix: prefix}
+}
+
+func (p prefixed) GetHashes(ctx context.Context) (map[string]string, error) {
+	return p.HashPrefix(ctx, "")
+}
+
+func (p prefixed) HashPrefix(ctx context.Context, prefix string) (map[string]string, error) {
+	all, err := GetHashes(ctx, p.Target, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(all))
+	for key, hash := range all {
+		if rel := strings.TrimPrefix(key, p.prefix); rel != "" {
+			hashes[rel] = hash
+		}
+	}
+	return hashes, nil
+}
+
+func (p prefixed) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	all, err := ListKeys(ctx, p.Target, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		keys = append(keys, strings.TrimPrefix(key, p.prefix))
+	}
+	return keys, nil
+}
+
+func (p prefixed) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	return p.Target.ReadFile(ctx, p.prefix+key)
+}
+
+func (p prefixed) WriteFile(ctx context.Context, key string, file io.Reader, opts ObjectOptions) error {
+	return p.Target.WriteFile(ctx, p.prefix+key, file, opts)
+}
+
+func (p prefixed) DeleteFiles(ctx context.Context, keys []string) error {
+	prefixedKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixedKeys = append(prefixedKeys, p.prefix+key)
+	}
+	return p.Target.DeleteFiles(ctx, prefixedKeys)
+}
+
+// ListKeys returns the keys of dest starting with prefix, sorted. Targets that are not a Lister
+// are listed through GetHashes.
+func ListKeys(ctx context.Context, dest Target, prefix string) ([]string, error) {
+	var keys []string
+	if lister, ok := dest.(Lister); ok {
+		listed, err := lister.ListKeys(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		keys = listed
+	} else {
+		hashes, err := dest.GetHashes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys = make([]string, 0)
+		for key := range hashes {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// GetHashes returns the hashes of the files of dest whose key starts with prefix. Targets that
+// are not a Hasher are hashed in full and filtered.
+func GetHashes(ctx context.Context, dest Target, prefix string) (map[string]string, error) {
+	if hasher, ok := dest.(Hasher); ok {
+		return hasher.HashPrefix(ctx, prefix)
+	}
+	all, err := dest.GetHashes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for key, hash := range all {
+		if strings.HasPrefix(key, prefix) {
+			hashes[key] = hash
+		}
+	}
+	return hashes, nil
+}
+
+// Open returns the target for rawURL, chosen by its scheme:
+//
+//	s3://bucket/prefix  a bucket, reached with the s3 connection settings
+//	file:///srv/www     a local directory kept as a mirror of the site
+//	mem://              an in memory store, mostly useful for tests and dry runs
+func Open(ctx context.Context, rawURL string, connection config.S3, retry aws.RetryPolicy) (Target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing target %s: %w - %w", rawURL, err, ErrInvalidTarget)
+	}
+
+	switch u.Scheme {
+	case SchemeS3:
+		bucket, prefix, err := ParseS3URL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		client, err := aws.NewS3Client(ctx, connection)
+		if err != nil {
+			return nil, err
+		}
+		return aws.New(client, bucket, prefix, retry), nil
+	case SchemeFile:
+		dir := u.Path
+		if u.Host != "" {
+			// file://relative/dir is read as a relative path rather than a remote host
+			dir = u.Host + u.Path
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("target %s has no directory: %w", rawURL, ErrInvalidTarget)
+		}
+		return NewDirectory(dir), nil
+	case SchemeMemory:
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("target %s has unknown scheme %q, expected s3, file or mem: %w", rawURL, u.Scheme, ErrInvalidTarget)
+}
+
+// ParseS3URL returns the bucket and key prefix of an s3://bucket/prefix target.
+func ParseS3URL(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing target %s: %w - %w", rawURL, err, ErrInvalidTarget)
+	}
+	if u.Scheme != SchemeS3 {
+		return "", "", fmt.Errorf("target %s is not an s3 bucket: %w", rawURL, ErrInvalidTarget)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("target %s has no bucket: %w", rawURL, ErrInvalidTarget)
+	}
+	return u.Host, aws.NormalizePrefix(u.Path), nil
+}
+
+// S3URL returns the target url for a bucket and optional key prefix.
+func S3URL(bucket, prefix string) string {
+	return SchemeS3 + "://" + bucket + "/" + aws.NormalizePrefix(prefix)
+}
+
+func calcMD5(r io.Reader) (string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,222 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rmarken5/blog-builder/tool/logic/aws"
+	"github.com/rmarken5/blog-builder/tool/logic/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should open a directory for file urls", func(t *testing.T) {
+		dest, err := Open(ctx, "file:///srv/www", config.S3{}, aws.RetryPolicy{})
+		require.NoError(t, err)
+		assert.Equal(t, &Directory{root: "/srv/www"}, dest)
+	})
+
+	t.Run("should read file urls with a host as relative paths", func(t *testing.T) {
+		dest, err := Open(ctx, "file://build/site", config.S3{}, aws.RetryPolicy{})
+		require.NoError(t, err)
+		assert.Equal(t, &Directory{root: "build/site"}, dest)
+	})
+
+	t.Run("should open a memory store for mem urls", func(t *testing.T) {
+		dest, err := Open(ctx, "mem://", config.S3{}, aws.RetryPolicy{})
+		require.NoError(t, err)
+		assert.IsType(t, &Memory{}, dest)
+	})
+
+	t.Run("should open a bucket for s3 urls", func(t *testing.T) {
+		dest, err := Open(ctx, "s3://my-blog/site", config.S3{Region: "us-east-2"}, aws.RetryPolicy{})
+		require.NoError(t, err)
+		assert.IsType(t, &aws.Client{}, dest)
+	})
+
+	t.Run("should reject unknown schemes and missing buckets", func(t *testing.T) {
+		_, err := Open(ctx, "ftp://host/path", config.S3{}, aws.RetryPolicy{})
+		assert.ErrorIs(t, err, ErrInvalidTarget)
+		_, err = Open(ctx, "s3:///path", config.S3{}, aws.RetryPolicy{})
+		assert.ErrorIs(t, err, ErrInvalidTarget)
+	})
+}
+
+func TestS3URL(t *testing.T) {
+	assert.Equal(t, "s3://my-blog/", S3URL("my-blog", ""))
+	assert.Equal(t, "s3://my-blog/site/", S3URL("my-blog", "/site"))
+}
+
+func TestParseS3URL(t *testing.T) {
+	bucket, prefix, err := ParseS3URL("s3://my-blog/site")
+	require.NoError(t, err)
+	assert.Equal(t, "my-blog", bucket)
+	assert.Equal(t, "site/", prefix)
+
+	_, _, err = ParseS3URL("file:///srv/www")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should treat a missing directory as empty", func(t *testing.T) {
+		hashes, err := NewDirectory(filepath.Join(t.TempDir(), "missing")).GetHashes(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+	})
+
+	t.Run("should write, hash and delete files", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "www")
+		dest := NewDirectory(root)
+
+		require.NoError(t, dest.WriteFile(ctx, "posts/hello.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"}))
+		b, err := os.ReadFile(filepath.Join(root, "posts", "hello.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+
+		hashes, err := dest.GetHashes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"posts/hello.html": helloMD5}, hashes)
+
+		require.NoError(t, dest.DeleteFiles(ctx, []string{"posts/hello.html", "never/existed.html"}))
+		hashes, err = dest.GetHashes(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+		assert.NoDirExists(t, filepath.Join(root, "posts"))
+		assert.DirExists(t, root)
+	})
+
+	t.Run("should list only the keys below a prefix", func(t *testing.T) {
+		dest := NewDirectory(t.TempDir())
+		for _, key := range []string{"index.html", ".deploys/b.json", ".deploys/a.json", ".deploys-old/c.json"} {
+			require.NoError(t, dest.WriteFile(ctx, key, strings.NewReader("x"), ObjectOptions{}))
+		}
+
+		keys, err := dest.ListKeys(ctx, ".deploys/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{".deploys/a.json", ".deploys/b.json"}, keys)
+		keys, err = dest.ListKeys(ctx, ".dep")
+		require.NoError(t, err)
+		assert.Len(t, keys, 3)
+		keys, err = dest.ListKeys(ctx, "missing/")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("should hash only the files below a prefix", func(t *testing.T) {
+		dest := NewDirectory(t.TempDir())
+		for _, key := range []string{"index.html", "releases/a/index.html", "releases/b/index.html"} {
+			require.NoError(t, dest.WriteFile(ctx, key, strings.NewReader("hello"), ObjectOptions{}))
+		}
+
+		hashes, err := dest.HashPrefix(ctx, "releases/a/")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"releases/a/index.html": helloMD5}, hashes)
+		hashes, err = dest.HashPrefix(ctx, "missing/")
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+	})
+
+	t.Run("should report missing files as not existing", func(t *testing.T) {
+		_, err := NewDirectory(t.TempDir()).ReadFile(ctx, "missing.html")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("should switch the current link between releases", func(t *testing.T) {
+		root := t.TempDir()
+		dest := NewDirectory(root)
+		require.NoError(t, dest.WriteFile(ctx, "releases/a/index.html", strings.NewReader("a"), ObjectOptions{ContentType: "text/html"}))
+		require.NoError(t, dest.WriteFile(ctx, "releases/b/index.html", strings.NewReader("b"), ObjectOptions{ContentType: "text/html"}))
+
+		active, err := dest.Active(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, active)
+		assert.Error(t, dest.Activate(ctx, "releases/missing/"))
+
+		for _, release := range []string{"a", "b"} {
+			require.NoError(t, dest.Activate(ctx, "releases/"+release+"/"))
+			active, err = dest.Active(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "releases/"+release+"/", active)
+			b, err := os.ReadFile(filepath.Join(root, "current", "index.html"))
+			require.NoError(t, err)
+			assert.Equal(t, release, string(b))
+		}
+
+		hashes, err := dest.GetHashes(ctx)
+		require.NoError(t, err)
+		assert.Len(t, hashes, 2, "the current link is not a file of its own")
+	})
+
+	t.Run("should refuse keys outside the directory", func(t *testing.T) {
+		err := NewDirectory(t.TempDir()).WriteFile(ctx, "../escape.html", strings.NewReader("x"), ObjectOptions{ContentType: "text/html"})
+		assert.ErrorIs(t, err, ErrInvalidTarget)
+	})
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	dest := NewMemory()
+
+	require.NoError(t, dest.WriteFile(ctx, "index.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"}))
+	require.NoError(t, dest.WriteFile(ctx, "old.html", strings.NewReader("old"), ObjectOptions{ContentType: "text/html"}))
+	require.NoError(t, dest.DeleteFiles(ctx, []string{"old.html"}))
+
+	hashes, err := dest.GetHashes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"index.html": helloMD5}, hashes)
+	assert.Equal(t, []string{"index.html"}, dest.Keys())
+	object, ok := dest.Get("index.html")
+	require.True(t, ok)
+	assert.Equal(t, Object{ObjectOptions: ObjectOptions{ContentType: "text/html"}, Body: []byte("hello")}, object)
+	_, err = dest.ReadFile(ctx, "old.html")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	dest := NewMemory()
+	require.NoError(t, dest.WriteFile(ctx, "index.html", strings.NewReader("root"), ObjectOptions{ContentType: "text/html"}))
+	release := WithPrefix(dest, "releases/a/")
+
+	require.NoError(t, release.WriteFile(ctx, "index.html", strings.NewReader("hello"), ObjectOptions{ContentType: "text/html"}))
+	require.NoError(t, release.WriteFile(ctx, "old.html", strings.NewReader("old"), ObjectOptions{ContentType: "text/html"}))
+	require.NoError(t, release.DeleteFiles(ctx, []string{"old.html"}))
+
+	hashes, err := release.GetHashes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"index.html": helloMD5}, hashes)
+	b, err := release.ReadFile(ctx, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, []string{"index.html", "releases/a/index.html"}, dest.Keys())
+	keys, err := ListKeys(ctx, release, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, keys)
+
+	t.Run("should hash only the keys below the prefix", func(t *testing.T) {
+		hashes, err := WithPrefix(unhashable{dest}, "releases/a/").GetHashes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"index.html": helloMD5}, hashes)
+	})
+}
+
+// unhashable is a memory target that fails when it is hashed in full.
+type unhashable struct {
+	*Memory
+}
+
+func (unhashable) GetHashes(ctx context.Context) (map[string]string, error) {
+	return nil, errors.New("hashed every file")
+}